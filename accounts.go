@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/HimbeerserverDE/srp"
+)
+
+var ErrUnknownUser = errors.New("unknown player")
+var ErrUserExists = errors.New("player already exists")
+var ErrPasswordRequired = errors.New("a new password is required because the name changes in more than case")
+
+// actorName returns the name used in log messages for a command issuer
+func actorName(c *Conn) string {
+	if c == nil {
+		return "console"
+	}
+
+	return c.Username()
+}
+
+// userExists reports whether an account exists
+func userExists(name string) (bool, error) {
+	v, _, err := Password(name)
+	return v != nil, err
+}
+
+// srpTokens computes the SRP verifier and salt of a password
+// The minetest client uses the lower case name for this
+func srpTokens(name, password string) ([]byte, []byte, error) {
+	if password == "" && Conf().DisallowEmptyPasswords {
+		return nil, nil, errors.New("empty passwords are not allowed")
+	}
+
+	salt, verifier, err := srp.NewClient([]byte(strings.ToLower(name)), []byte(password))
+	return verifier, salt, err
+}
+
+// DeleteAccount kicks a player and removes its account,
+// privileges, roles and last server
+func DeleteAccount(name string) error {
+	exists, err := userExists(name)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrUnknownUser
+	}
+
+	if c := ConnByUsername(name); c != nil {
+		c.CloseWith(AccessDeniedCustomString, "Your account has been deleted.", false)
+	}
+
+	if err := Auth().DeleteUser(name); err != nil {
+		return err
+	}
+
+	return SetStorageKey("server:"+name, "")
+}
+
+// RenameAccount kicks a player and moves its account, privileges,
+// bans, mute and last server to a new name
+// The SRP verifier depends on the lower case name, if that changes
+// a new password must be provided
+func RenameAccount(name, newName, password string) error {
+	if !ValidPlayerName(newName) {
+		return fmt.Errorf("invalid name %s", newName)
+	}
+
+	exists, err := userExists(name)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrUnknownUser
+	}
+
+	existing, err := Auth().FindUser(newName)
+	if err != nil {
+		return err
+	}
+
+	if existing != "" && existing != name {
+		return ErrUserExists
+	}
+
+	var verifier, salt []byte
+	if strings.ToLower(name) != strings.ToLower(newName) {
+		if password == "" {
+			return ErrPasswordRequired
+		}
+
+		verifier, salt, err = srpTokens(newName, password)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c := ConnByUsername(name); c != nil {
+		c.CloseWith(AccessDeniedCustomString, "Your account has been renamed to "+newName+".", false)
+	}
+
+	if err := Auth().RenameUser(name, newName); err != nil {
+		return err
+	}
+
+	if verifier != nil {
+		if err := Auth().SetPassword(newName, verifier, salt); err != nil {
+			return err
+		}
+	}
+
+	srv, err := StorageKey("server:" + name)
+	if err != nil {
+		return err
+	}
+
+	if err := SetStorageKey("server:"+newName, srv); err != nil {
+		return err
+	}
+
+	return SetStorageKey("server:"+name, "")
+}
+
+// ResetPassword sets a new password for an account
+func ResetPassword(name, password string) error {
+	exists, err := userExists(name)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrUnknownUser
+	}
+
+	verifier, salt, err := srpTokens(name, password)
+	if err != nil {
+		return err
+	}
+
+	return SetPassword(name, verifier, salt)
+}
+
+// NameCollisions returns the accounts whose names only differ in case
+// grouped by the lower case name
+func NameCollisions() (map[string][]string, error) {
+	users, err := Auth().UserList()
+	if err != nil {
+		return nil, err
+	}
+
+	byLower := make(map[string][]string)
+	for _, name := range users {
+		lower := strings.ToLower(name)
+		byLower[lower] = append(byLower[lower], name)
+	}
+
+	r := make(map[string][]string)
+	for lower, names := range byLower {
+		if len(names) > 1 {
+			sort.Strings(names)
+			r[lower] = names
+		}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const activityTimeFormat = "2006-01-02 15:04:05 MST"
+
+// An Activity records when and from where an account has played
+// Times are zero if they are unknown
+type Activity struct {
+	FirstLogin time.Time
+	LastLogin  time.Time
+	LastAddr   string
+	Playtime   time.Duration
+}
+
+// PlayerActivity returns the activity record of an account
+// The current session of an online player is included in Playtime
+func PlayerActivity(name string) (*Activity, error) {
+	a, err := Auth().Activity(name)
+	if err != nil || a == nil {
+		return a, err
+	}
+
+	if c := ConnByUsername(name); c != nil {
+		onlinePlayerMu.RLock()
+		if !c.joinTime.IsZero() {
+			a.Playtime += time.Since(c.joinTime)
+		}
+		onlinePlayerMu.RUnlock()
+	}
+
+	return a, nil
+}
+
+// startSession marks the start of the session of a Conn that has joined
+// onlinePlayerMu must be locked by the caller
+func startSession(c *Conn) time.Time {
+	c.joinTime = time.Now()
+	return c.joinTime
+}
+
+// endSession ends the session of a Conn that has left
+// and returns its length
+// onlinePlayerMu must be locked by the caller
+func endSession(c *Conn) time.Duration {
+	if c.joinTime.IsZero() {
+		return 0
+	}
+
+	session := time.Since(c.joinTime)
+	c.joinTime = time.Time{}
+
+	return session
+}
+
+// recordLogin updates the activity record of an account
+// that has logged in from addr
+// onlinePlayerMu must not be locked by the caller
+// because the auth backend may be slow
+func recordLogin(name, addr string, t time.Time) {
+	if err := Auth().RecordLogin(name, addr, t); err != nil {
+		log.Print(err)
+	}
+}
+
+// recordLogout adds a session to the playtime of an account
+// onlinePlayerMu must not be locked by the caller
+// because the auth backend may be slow
+func recordLogout(name string, session time.Duration) {
+	if session == 0 {
+		return
+	}
+
+	if err := Auth().AddPlaytime(name, session); err != nil {
+		log.Print(err)
+	}
+}
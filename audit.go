@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// An AuditEntry records a state-changing command or RPC request
+type AuditEntry struct {
+	ID   int64
+	Time time.Time
+	// Actor is the player, console or rpc:<server> that issued the command
+	Actor  string
+	Action string
+	// Target is the player, address or server that was affected,
+	// it is empty if there is none
+	Target string
+	Args   string
+}
+
+// Audit appends an entry to the audit log
+// Errors are logged, they never prevent the action itself
+func Audit(actor, action, target, args string) {
+	err := Auth().Audit(&AuditEntry{
+		Time:   time.Now(),
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		Args:   args,
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// AuditLog returns the latest limit entries of the audit log
+// that were issued by or affected a player, newest first
+// All entries are searched if name is empty
+func AuditLog(name string, limit int) ([]AuditEntry, error) {
+	return Auth().AuditLog(name, limit)
+}
@@ -2,13 +2,12 @@ package main
 
 import (
 	"crypto/rand"
-	"database/sql"
 	"encoding/base64"
 	"errors"
 	"log"
 	"strings"
-
-	_ "github.com/mattn/go-sqlite3"
+	"sync"
+	"time"
 )
 
 const (
@@ -18,14 +17,54 @@ const (
 )
 
 var passPhrase []byte
+var passPhraseMu sync.RWMutex
+
+// passphrase returns the passphrase used for the minetest servers,
+// it is nil if it hasn't been loaded
+func passphrase() []byte {
+	passPhraseMu.RLock()
+	defer passPhraseMu.RUnlock()
+
+	return passPhrase
+}
+
+func setPassphrase(p []byte) {
+	passPhraseMu.Lock()
+	defer passPhraseMu.Unlock()
+
+	passPhrase = p
+}
+
+var ErrInvalidPassword = errors.New("invalid password entry")
+
+// encodePassphrase converts a passphrase to text
+// because it may not be valid UTF-8 which PostgreSQL refuses to store
+func encodePassphrase(p []byte) string {
+	return "base64:" + base64.StdEncoding.EncodeToString(p)
+}
+
+// decodePassphrase reverses encodePassphrase
+// Passphrases that were stored without encoding are returned unchanged
+func decodePassphrase(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "base64:") {
+		return []byte(s), nil
+	}
+
+	return base64.StdEncoding.DecodeString(strings.TrimPrefix(s, "base64:"))
+}
 
 func encodeVerifierAndSalt(s, v []byte) string {
 	return base64.StdEncoding.EncodeToString(s) + "#" + base64.StdEncoding.EncodeToString(v)
 }
 
 func decodeVerifierAndSalt(src string) ([]byte, []byte, error) {
-	sString := strings.Split(src, "#")[0]
-	vString := strings.Split(src, "#")[1]
+	parts := strings.Split(src, "#")
+	if len(parts) != 2 {
+		return nil, nil, ErrInvalidPassword
+	}
+
+	sString := parts[0]
+	vString := parts[1]
 
 	s, err := base64.StdEncoding.DecodeString(sString)
 	if err != nil {
@@ -40,145 +79,194 @@ func decodeVerifierAndSalt(src string) ([]byte, []byte, error) {
 	return s, v, nil
 }
 
-func authDB() (*DB, error) {
-	sqlite3 := func() (*DB, error) {
-		return OpenSQLite3("auth.sqlite", `CREATE TABLE IF NOT EXISTS auth (
-	name VARCHAR(32) PRIMARY KEY NOT NULL,
-	password VARCHAR(512) NOT NULL
-);
-CREATE TABLE IF NOT EXISTS privileges (
-	name VARCHAR(32) PRIMARY KEY NOT NULL,
-	privileges VARCHAR(1024)
-);
-CREATE TABLE IF NOT EXISTS ban (
-	addr VARCHAR(39) PRIMARY KEY NOT NULL,
-	name VARCHAR(32) NOT NULL
-);`)
-	}
+// An AuthBackend stores accounts, privileges and bans
+type AuthBackend interface {
+	// CreateUser creates a new account and adds privs
+	// to the privileges of the player atomically, privs may be nil
+	CreateUser(name string, verifier, salt []byte, privs map[string]bool) error
+	// Password returns the SRP verifier and salt of an account,
+	// both are nil if the account doesn't exist
+	Password(name string) (verifier, salt []byte, err error)
+	// SetPassword changes the SRP verifier and salt of an account
+	SetPassword(name string, verifier, salt []byte) error
+	// FindUser returns the name of an account whose name equals name
+	// ignoring case, it is empty if there is none
+	FindUser(name string) (string, error)
+	// DeleteUser removes an account, its privileges and its roles
+	DeleteUser(name string) error
+	// RenameUser moves an account, its privileges, its roles,
+	// its bans and its mute to a new name
+	RenameUser(name, newName string) error
+	// UserList returns the names of all accounts
+	UserList() ([]string, error)
+	// Activity returns the activity record of an account,
+	// it is nil if the account doesn't exist
+	Activity(name string) (*Activity, error)
+	// SetActivity replaces the activity record of an account
+	SetActivity(name string, a *Activity) error
+	// RecordLogin sets the last login of an account and
+	// the first login if it is unknown, in a single update
+	RecordLogin(name, addr string, t time.Time) error
+	// AddPlaytime adds to the playtime of an account in a single update
+	AddPlaytime(name string, d time.Duration) error
 
-	psql := func(name, user, password, host string, port int) (*DB, error) {
-		return OpenPSQL(name, user, password, `CREATE TABLE IF NOT EXISTS auth (
-	name VARCHAR(32) PRIMARY KEY NOT NULL,
-	password VARCHAR(512) NOT NULL
-);
-CREATE TABLE IF NOT EXISTS privileges (
-	name VARCHAR(32) PRIMARY KEY NOT NULL,
-	privileges VARCHAR(1024)
-);
-CREATE TABLE IF NOT EXISTS ban (
-	addr VARCHAR(39) PRIMARY KEY NOT NULL,
-	name VARCHAR(32) NOT NULL
-);`, host, port)
-	}
+	// Privs returns the privileges of a player
+	Privs(name string) (map[string]bool, error)
+	// SetPrivs replaces the privileges of a player
+	SetPrivs(name string, privs map[string]bool) error
+	// PrivsList returns the privileges of all players
+	PrivsList() (map[string]map[string]bool, error)
+	// Roles returns the roles of a player
+	Roles(name string) (map[string]bool, error)
+	// SetRoles replaces the roles of a player
+	SetRoles(name string, roles map[string]bool) error
+	// RolesList returns the roles of all players
+	RolesList() (map[string]map[string]bool, error)
 
-	db, ok := ConfKey("psql_db").(string)
-	if !ok {
-		return sqlite3()
-	}
+	// Whitelist returns the names on the whitelist
+	Whitelist() ([]string, error)
+	// IsWhitelisted reports whether a name is on the whitelist
+	// ignoring case
+	IsWhitelisted(name string) (bool, error)
+	// WhitelistAdd adds a name to the whitelist
+	WhitelistAdd(name string) error
+	// WhitelistRemove removes a name from the whitelist
+	WhitelistRemove(name string) error
 
-	host, ok := ConfKey("psql_host").(string)
-	if !ok {
-		host = "localhost"
-	}
+	// Bans returns the entries of the ban list that have not expired
+	Bans() ([]BanEntry, error)
+	// FindBan returns the ban of an IP address,
+	// nil if it isn't banned or the ban has expired
+	FindBan(addr string) (*BanEntry, error)
+	// Ban adds an entry to the ban list
+	// An existing entry of the same address is replaced
+	Ban(b *BanEntry) error
+	// Unban removes all entries matching an IP address or a name
+	// from the ban list
+	Unban(id string) error
 
-	port, ok := ConfKey("psql_port").(int)
-	if !ok {
-		port = 5432
-		return sqlite3()
-	}
+	// NameBans returns the account bans that have not expired
+	// Addr is empty for all of them
+	NameBans() ([]BanEntry, error)
+	// FindNameBan returns the ban of an account ignoring case,
+	// nil if it isn't banned or the ban has expired
+	FindNameBan(name string) (*BanEntry, error)
+	// BanName adds an account ban, an existing ban
+	// of the same name ignoring case is replaced
+	BanName(b *BanEntry) error
+	// UnbanName removes the ban of an account ignoring case
+	UnbanName(name string) error
 
-	user, ok := ConfKey("psql_user").(string)
-	if !ok {
-		log.Print("PostgreSQL user not set or not a string")
-		return sqlite3()
+	// Audit appends an entry to the audit log
+	Audit(e *AuditEntry) error
+	// AuditLog returns the latest limit entries of the audit log
+	// whose actor or target equals name ignoring case, newest first
+	// All entries are searched if name is empty
+	AuditLog(name string, limit int) ([]AuditEntry, error)
+
+	// Mutes returns the mutes that have not expired
+	Mutes() ([]Mute, error)
+	// FindMute returns the mute of a player ignoring case,
+	// nil if it isn't muted or the mute has expired
+	FindMute(name string) (*Mute, error)
+	// Mute adds a mute, an existing mute of the same name
+	// ignoring case is replaced
+	Mute(m *Mute) error
+	// Unmute removes the mute of a player ignoring case
+	Unmute(name string) error
+}
+
+var authBackend AuthBackend
+var authBackendMu sync.RWMutex
+
+// Auth returns the AuthBackend that is in use
+// The backend selected by auth_backend is opened on first use
+// unless SetAuthBackend has been called before
+func Auth() AuthBackend {
+	authBackendMu.RLock()
+	b := authBackend
+	authBackendMu.RUnlock()
+
+	if b != nil {
+		return b
 	}
 
-	password, ok := ConfKey("psql_password").(string)
-	if !ok {
-		log.Print("PostgreSQL password not set or not a string")
-		return sqlite3()
+	authBackendMu.Lock()
+	defer authBackendMu.Unlock()
+
+	if authBackend == nil {
+		switch Conf().AuthBackend {
+		case "memory":
+			authBackend = NewMemAuthBackend()
+		default:
+			db, err := authDB()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			authBackend = NewSQLAuthBackend(db)
+		}
 	}
 
-	return psql(db, user, password, host, port)
+	return authBackend
+}
+
+// SetAuthBackend replaces the AuthBackend
+// This should be done before the proxy starts accepting clients
+func SetAuthBackend(b AuthBackend) {
+	authBackendMu.Lock()
+	defer authBackendMu.Unlock()
+
+	authBackend = b
 }
 
 // CreateUser creates a new entry in the authentication database
+// The default privileges are granted to the new account
 func CreateUser(name string, verifier, salt []byte) error {
-	db, err := authDB()
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	pwd := encodeVerifierAndSalt(salt, verifier)
-
-	_, err = db.Exec(`INSERT INTO auth (
-	name,
-	password
-) VALUES (
-	$1,
-	$2
-);`, name, pwd)
-	return err
+	return Auth().CreateUser(name, verifier, salt, DefaultPrivs())
 }
 
 // Password returns the SRP tokens of a user
 func Password(name string) ([]byte, []byte, error) {
-	db, err := authDB()
-	if err != nil {
-		return nil, nil, err
-	}
-	defer db.Close()
-
-	var pwd string
-	err = db.QueryRow(`SELECT password FROM auth WHERE name = $1;`, name).Scan(&pwd)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return nil, nil, err
-	}
-
-	if pwd == "" {
-		return nil, nil, nil
-	}
-
-	salt, verifier, err := decodeVerifierAndSalt(pwd)
-	return verifier, salt, err
+	return Auth().Password(name)
 }
 
 // SetPassword changes the SRP tokens of a user
 func SetPassword(name string, verifier, salt []byte) error {
-	db, err := authDB()
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	pwd := encodeVerifierAndSalt(salt, verifier)
-
-	_, err = db.Exec(`UPDATE auth SET password = $1 WHERE name = $2;`, pwd, name)
-	return err
+	return Auth().SetPassword(name, verifier, salt)
 }
 
-func init() {
+// initPassphrase loads the passphrase used for the minetest servers
+// or generates a new one
+func initPassphrase() {
 	pwd, err := StorageKey("auth:passphrase")
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	if pwd == "" {
-		passPhrase = make([]byte, 16)
-		_, err := rand.Read(passPhrase)
+		p := make([]byte, 16)
+		_, err := rand.Read(p)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 		// Save the passphrase for future use
 		// This passphrase should not be changed wihtout deleting
-		// the auth databases on the minetest servers
-		err = SetStorageKey("auth:passphrase", string(passPhrase))
+		// the auth databases on the minetest servers,
+		// the passwords derived from it can be rotated instead
+		err = SetStorageKey("auth:passphrase", encodePassphrase(p))
 		if err != nil {
 			log.Fatal(err)
 		}
+
+		setPassphrase(p)
 	} else {
-		passPhrase = []byte(pwd)
+		p, err := decodePassphrase(pwd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		setPassphrase(p)
 	}
 }
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A MemAuthBackend is an AuthBackend that keeps everything in memory
+// It is useful for tests and plugins, nothing is persisted
+type MemAuthBackend struct {
+	mu        sync.RWMutex
+	passwords map[string]string
+	activity  map[string]Activity
+	privs     map[string]map[string]bool
+	roles     map[string]map[string]bool
+	whitelist map[string]bool
+	bans      map[string]BanEntry
+	nameBans  map[string]BanEntry
+	mutes     map[string]Mute
+	audit     []AuditEntry
+}
+
+// NewMemAuthBackend returns an empty MemAuthBackend
+func NewMemAuthBackend() *MemAuthBackend {
+	return &MemAuthBackend{
+		passwords: make(map[string]string),
+		activity:  make(map[string]Activity),
+		privs:     make(map[string]map[string]bool),
+		roles:     make(map[string]map[string]bool),
+		whitelist: make(map[string]bool),
+		bans:      make(map[string]BanEntry),
+		nameBans:  make(map[string]BanEntry),
+		mutes:     make(map[string]Mute),
+	}
+}
+
+// CreateUser creates a new account and adds privs
+// to the privileges of the player
+func (b *MemAuthBackend) CreateUser(name string, verifier, salt []byte, privs map[string]bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.collides(name, "") {
+		return ErrUserExists
+	}
+
+	b.passwords[name] = encodeVerifierAndSalt(salt, verifier)
+
+	for priv, has := range privs {
+		if !has {
+			continue
+		}
+
+		if b.privs[name] == nil {
+			b.privs[name] = make(map[string]bool)
+		}
+
+		b.privs[name][priv] = true
+	}
+
+	return nil
+}
+
+// Password returns the SRP tokens of a user
+func (b *MemAuthBackend) Password(name string) ([]byte, []byte, error) {
+	b.mu.RLock()
+	pwd := b.passwords[name]
+	b.mu.RUnlock()
+
+	if pwd == "" {
+		return nil, nil, nil
+	}
+
+	salt, verifier, err := decodeVerifierAndSalt(pwd)
+	return verifier, salt, err
+}
+
+// SetPassword changes the SRP tokens of a user
+func (b *MemAuthBackend) SetPassword(name string, verifier, salt []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.passwords[name]; ok {
+		b.passwords[name] = encodeVerifierAndSalt(salt, verifier)
+	}
+
+	return nil
+}
+
+// FindUser returns the name of an account whose name equals name ignoring case
+func (b *MemAuthBackend) FindUser(name string) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var r string
+	for n := range b.passwords {
+		if strings.EqualFold(n, name) && (r == "" || n < r) {
+			r = n
+		}
+	}
+
+	return r, nil
+}
+
+// collides reports whether an account other than except exists
+// whose name equals name ignoring case
+// b.mu must be locked by the caller
+func (b *MemAuthBackend) collides(name, except string) bool {
+	for n := range b.passwords {
+		if n != except && strings.EqualFold(n, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeleteUser removes an account, its privileges and its roles
+func (b *MemAuthBackend) DeleteUser(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.passwords, name)
+	delete(b.activity, name)
+	delete(b.privs, name)
+	delete(b.roles, name)
+
+	return nil
+}
+
+// RenameUser moves an account, its privileges, its roles, its bans
+// and its mute to a new name
+func (b *MemAuthBackend) RenameUser(name, newName string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.collides(newName, name) {
+		return ErrUserExists
+	}
+
+	if pwd, ok := b.passwords[name]; ok {
+		b.passwords[newName] = pwd
+		b.activity[newName] = b.activity[name]
+
+		delete(b.passwords, name)
+		delete(b.activity, name)
+	}
+
+	delete(b.privs, newName)
+	if privs, ok := b.privs[name]; ok {
+		b.privs[newName] = privs
+		delete(b.privs, name)
+	}
+
+	delete(b.roles, newName)
+	if roles, ok := b.roles[name]; ok {
+		b.roles[newName] = roles
+		delete(b.roles, name)
+	}
+
+	for addr, e := range b.bans {
+		if e.Name == name {
+			e.Name = newName
+			b.bans[addr] = e
+		}
+	}
+
+	if e, ok := b.nameBans[strings.ToLower(name)]; ok && e.Name == name {
+		e.Name = newName
+		delete(b.nameBans, strings.ToLower(name))
+		b.nameBans[strings.ToLower(newName)] = e
+	}
+
+	if m, ok := b.mutes[strings.ToLower(name)]; ok && m.Name == name {
+		m.Name = newName
+		delete(b.mutes, strings.ToLower(name))
+		b.mutes[strings.ToLower(newName)] = m
+	}
+
+	return nil
+}
+
+// UserList returns the names of all accounts
+func (b *MemAuthBackend) UserList() ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	r := make([]string, 0, len(b.passwords))
+	for name := range b.passwords {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+
+	return r, nil
+}
+
+// Activity returns the activity record of an account
+func (b *MemAuthBackend) Activity(name string) (*Activity, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, ok := b.passwords[name]; !ok {
+		return nil, nil
+	}
+
+	a := b.activity[name]
+	return &a, nil
+}
+
+// SetActivity replaces the activity record of an account
+func (b *MemAuthBackend) SetActivity(name string, a *Activity) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.passwords[name]; ok {
+		b.activity[name] = *a
+	}
+
+	return nil
+}
+
+// RecordLogin sets the last login of an account
+// and the first login if it is unknown
+func (b *MemAuthBackend) RecordLogin(name, addr string, t time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.passwords[name]; ok {
+		a := b.activity[name]
+		if a.FirstLogin.IsZero() {
+			a.FirstLogin = t
+		}
+
+		a.LastLogin = t
+		a.LastAddr = addr
+
+		b.activity[name] = a
+	}
+
+	return nil
+}
+
+// AddPlaytime adds to the playtime of an account
+func (b *MemAuthBackend) AddPlaytime(name string, d time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.passwords[name]; ok {
+		a := b.activity[name]
+		a.Playtime += d
+		b.activity[name] = a
+	}
+
+	return nil
+}
+
+// Privs returns the privileges of a player
+func (b *MemAuthBackend) Privs(name string) (map[string]bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	r := make(map[string]bool)
+	for priv, has := range b.privs[name] {
+		if has {
+			r[priv] = true
+		}
+	}
+
+	return r, nil
+}
+
+// SetPrivs sets the privileges of a player
+func (b *MemAuthBackend) SetPrivs(name string, privs map[string]bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p := make(map[string]bool)
+	for priv, has := range privs {
+		if has {
+			p[priv] = true
+		}
+	}
+
+	b.privs[name] = p
+	return nil
+}
+
+// PrivsList returns the privileges of all players
+func (b *MemAuthBackend) PrivsList() (map[string]map[string]bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	r := make(map[string]map[string]bool)
+	for name, privs := range b.privs {
+		p := make(map[string]bool)
+		for priv := range privs {
+			p[priv] = true
+		}
+
+		r[name] = p
+	}
+
+	return r, nil
+}
+
+// Roles returns the roles of a player
+func (b *MemAuthBackend) Roles(name string) (map[string]bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	r := make(map[string]bool)
+	for role := range b.roles[name] {
+		r[role] = true
+	}
+
+	return r, nil
+}
+
+// SetRoles sets the roles of a player
+func (b *MemAuthBackend) SetRoles(name string, roles map[string]bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r := make(map[string]bool)
+	for role, has := range roles {
+		if has {
+			r[role] = true
+		}
+	}
+
+	if len(r) == 0 {
+		delete(b.roles, name)
+		return nil
+	}
+
+	b.roles[name] = r
+	return nil
+}
+
+// RolesList returns the roles of all players
+func (b *MemAuthBackend) RolesList() (map[string]map[string]bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	r := make(map[string]map[string]bool)
+	for name, roles := range b.roles {
+		p := make(map[string]bool)
+		for role := range roles {
+			p[role] = true
+		}
+
+		r[name] = p
+	}
+
+	return r, nil
+}
+
+// Whitelist returns the names on the whitelist
+func (b *MemAuthBackend) Whitelist() ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	r := make([]string, 0, len(b.whitelist))
+	for name := range b.whitelist {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+
+	return r, nil
+}
+
+// IsWhitelisted reports whether a name is on the whitelist ignoring case
+func (b *MemAuthBackend) IsWhitelisted(name string) (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for n := range b.whitelist {
+		if strings.EqualFold(n, name) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// WhitelistAdd adds a name to the whitelist
+func (b *MemAuthBackend) WhitelistAdd(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.whitelist[name] = true
+	return nil
+}
+
+// WhitelistRemove removes a name from the whitelist
+func (b *MemAuthBackend) WhitelistRemove(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for n := range b.whitelist {
+		if strings.EqualFold(n, name) {
+			delete(b.whitelist, n)
+		}
+	}
+
+	return nil
+}
+
+// Bans returns the bans that have not expired
+func (b *MemAuthBackend) Bans() ([]BanEntry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var r []BanEntry
+	for _, e := range b.bans {
+		if !e.Expired() {
+			r = append(r, e)
+		}
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Addr < r[j].Addr
+	})
+
+	return r, nil
+}
+
+// FindBan returns the ban of an IP address if it has not expired
+func (b *MemAuthBackend) FindBan(addr string) (*BanEntry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	e, ok := b.bans[addr]
+	if !ok || e.Expired() {
+		return nil, nil
+	}
+
+	return &e, nil
+}
+
+// Ban adds an entry to the ban list
+// An existing entry of the same address is replaced
+func (b *MemAuthBackend) Ban(e *BanEntry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bans[e.Addr] = *e
+	return nil
+}
+
+// Unban removes a player from the ban list
+func (b *MemAuthBackend) Unban(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for addr, e := range b.bans {
+		if addr == id || e.Name == id {
+			delete(b.bans, addr)
+		}
+	}
+
+	return nil
+}
+
+// NameBans returns the account bans that have not expired
+func (b *MemAuthBackend) NameBans() ([]BanEntry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var r []BanEntry
+	for _, e := range b.nameBans {
+		if !e.Expired() {
+			r = append(r, e)
+		}
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Name < r[j].Name
+	})
+
+	return r, nil
+}
+
+// FindNameBan returns the ban of an account if it has not expired
+func (b *MemAuthBackend) FindNameBan(name string) (*BanEntry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	e, ok := b.nameBans[strings.ToLower(name)]
+	if !ok || e.Expired() {
+		return nil, nil
+	}
+
+	return &e, nil
+}
+
+// BanName adds an account ban
+// An existing ban of the same name ignoring case is replaced
+func (b *MemAuthBackend) BanName(e *BanEntry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nameBans[strings.ToLower(e.Name)] = *e
+	return nil
+}
+
+// UnbanName removes the ban of an account
+func (b *MemAuthBackend) UnbanName(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.nameBans, strings.ToLower(name))
+	return nil
+}
+
+// Mutes returns the mutes that have not expired
+func (b *MemAuthBackend) Mutes() ([]Mute, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var r []Mute
+	for _, m := range b.mutes {
+		if !m.Expired() {
+			r = append(r, m)
+		}
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Name < r[j].Name
+	})
+
+	return r, nil
+}
+
+// FindMute returns the mute of a player if it has not expired
+func (b *MemAuthBackend) FindMute(name string) (*Mute, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	m, ok := b.mutes[strings.ToLower(name)]
+	if !ok || m.Expired() {
+		return nil, nil
+	}
+
+	return &m, nil
+}
+
+// Mute adds a mute
+// An existing mute of the same name ignoring case is replaced
+func (b *MemAuthBackend) Mute(m *Mute) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.mutes[strings.ToLower(m.Name)] = *m
+	return nil
+}
+
+// Unmute removes the mute of a player
+func (b *MemAuthBackend) Unmute(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.mutes, strings.ToLower(name))
+	return nil
+}
+
+// Audit appends an entry to the audit log
+func (b *MemAuthBackend) Audit(e *AuditEntry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry := *e
+	entry.ID = int64(len(b.audit) + 1)
+
+	b.audit = append(b.audit, entry)
+	return nil
+}
+
+// AuditLog returns the latest entries of the audit log
+// issued by or affecting a player
+func (b *MemAuthBackend) AuditLog(name string, limit int) ([]AuditEntry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var r []AuditEntry
+	for i := len(b.audit) - 1; i >= 0 && len(r) < limit; i-- {
+		e := b.audit[i]
+		if name == "" || strings.EqualFold(e.Actor, name) || strings.EqualFold(e.Target, name) {
+			r = append(r, e)
+		}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,881 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var authDb *DB
+var authDbMu sync.Mutex
+
+// authDB returns the authentication database
+// It is opened on first use and stays open until End is called
+// Opening is retried on the next call if it fails
+func authDB() (*DB, error) {
+	authDbMu.Lock()
+	defer authDbMu.Unlock()
+
+	if authDb == nil {
+		db, err := openAuthDB()
+		if err != nil {
+			return nil, err
+		}
+
+		authDb = db
+	}
+
+	return authDb, nil
+}
+
+// authMigrations are the versions of the authentication database schema
+// New migrations must be appended, existing ones must never be changed
+var authMigrations = []Migration{
+	{SQLite3: `CREATE TABLE IF NOT EXISTS auth (
+	name VARCHAR(32) PRIMARY KEY NOT NULL,
+	password VARCHAR(512) NOT NULL
+);
+CREATE TABLE IF NOT EXISTS privileges (
+	name VARCHAR(32) PRIMARY KEY NOT NULL,
+	privileges VARCHAR(1024)
+);
+CREATE TABLE IF NOT EXISTS ban (
+	addr VARCHAR(39) PRIMARY KEY NOT NULL,
+	name VARCHAR(32) NOT NULL
+);`},
+	{SQLite3: `ALTER TABLE auth ADD COLUMN first_login BIGINT;
+ALTER TABLE auth ADD COLUMN last_login BIGINT;
+ALTER TABLE auth ADD COLUMN last_addr VARCHAR(39);
+ALTER TABLE auth ADD COLUMN playtime BIGINT NOT NULL DEFAULT 0;`},
+	{SQLite3: `CREATE INDEX IF NOT EXISTS auth_name_lower ON auth (LOWER(name));`},
+	{SQLite3: `CREATE TABLE IF NOT EXISTS whitelist (
+	name VARCHAR(32) PRIMARY KEY NOT NULL
+);`},
+	{SQLite3: `ALTER TABLE ban ADD COLUMN reason VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE ban ADD COLUMN issuer VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE ban ADD COLUMN created BIGINT;
+ALTER TABLE ban ADD COLUMN expires BIGINT;`},
+	{SQLite3: `CREATE TABLE IF NOT EXISTS name_ban (
+	name VARCHAR(32) PRIMARY KEY NOT NULL,
+	reason VARCHAR(512) NOT NULL DEFAULT '',
+	issuer VARCHAR(64) NOT NULL DEFAULT '',
+	created BIGINT,
+	expires BIGINT
+);`},
+	// SQLite3 doesn't enforce the length, CIDR ranges need 43 characters
+	{PSQL: `ALTER TABLE ban ALTER COLUMN addr TYPE VARCHAR(43);`},
+	{SQLite3: `CREATE TABLE IF NOT EXISTS mute (
+	name VARCHAR(32) PRIMARY KEY NOT NULL,
+	reason VARCHAR(512) NOT NULL DEFAULT '',
+	issuer VARCHAR(64) NOT NULL DEFAULT '',
+	created BIGINT,
+	expires BIGINT
+);`},
+	{SQLite3: `CREATE TABLE IF NOT EXISTS roles (
+	name VARCHAR(32) PRIMARY KEY NOT NULL,
+	roles VARCHAR(1024)
+);`},
+	{SQLite3: `CREATE TABLE IF NOT EXISTS audit (
+	id INTEGER PRIMARY KEY,
+	created BIGINT NOT NULL,
+	actor VARCHAR(64) NOT NULL,
+	action VARCHAR(32) NOT NULL,
+	target VARCHAR(64) NOT NULL DEFAULT '',
+	args VARCHAR(1024) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS audit_actor ON audit (LOWER(actor));
+CREATE INDEX IF NOT EXISTS audit_target ON audit (LOWER(target));`, PSQL: `CREATE TABLE IF NOT EXISTS audit (
+	id SERIAL PRIMARY KEY,
+	created BIGINT NOT NULL,
+	actor VARCHAR(64) NOT NULL,
+	action VARCHAR(32) NOT NULL,
+	target VARCHAR(64) NOT NULL DEFAULT '',
+	args VARCHAR(1024) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS audit_actor ON audit (LOWER(actor));
+CREATE INDEX IF NOT EXISTS audit_target ON audit (LOWER(target));`},
+	// Of the accounts whose names only differ in case that were created
+	// before, the one that logged in first keeps the name
+	// The others keep a NULL name_lower, they are logged on startup
+	// and listed by the collisions command
+	{SQLite3: `ALTER TABLE auth ADD COLUMN name_lower VARCHAR(32);
+UPDATE auth SET name_lower = LOWER(name) WHERE name = (
+	SELECT a.name FROM auth a WHERE LOWER(a.name) = LOWER(auth.name)
+	ORDER BY a.first_login IS NULL, a.first_login, a.name LIMIT 1
+);
+CREATE UNIQUE INDEX IF NOT EXISTS auth_name_lower_unique ON auth (name_lower);`},
+}
+
+func openAuthDB() (*DB, error) {
+	db, err := OpenConfDB("auth.sqlite")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Migrate("auth", authMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	logNameCollisions(db)
+
+	return db, nil
+}
+
+// logNameCollisions logs the accounts whose names only differ
+// in case from the name of an older account
+func logNameCollisions(db *DB) {
+	rows, err := db.Query(`SELECT name FROM auth WHERE name_lower IS NULL;`)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Print(err)
+			return
+		}
+
+		log.Print("Account " + name + " collides with an older account whose name only differs in case, see the collisions command")
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+	}
+}
+
+// A SQLAuthBackend is an AuthBackend that uses
+// a SQLite3 or PostgreSQL database
+type SQLAuthBackend struct {
+	db *DB
+}
+
+// NewSQLAuthBackend returns an AuthBackend that uses db
+// The schema of db must have been migrated to authMigrations
+func NewSQLAuthBackend(db *DB) *SQLAuthBackend {
+	return &SQLAuthBackend{db: db}
+}
+
+// CreateUser creates a new entry in the authentication database
+// and adds privs to the privileges of the player in the same transaction
+func (b *SQLAuthBackend) CreateUser(name string, verifier, salt []byte, privs map[string]bool) error {
+	pwd := encodeVerifierAndSalt(salt, verifier)
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(b.db.rebind(`INSERT INTO auth (
+	name,
+	name_lower,
+	password
+) VALUES (
+	$1,
+	$2,
+	$3
+);`), name, strings.ToLower(name), pwd)
+	if err != nil {
+		tx.Rollback()
+
+		if isUniqueViolation(err) {
+			return ErrUserExists
+		}
+
+		return err
+	}
+
+	if len(privs) > 0 {
+		// Privileges may have been granted before the account was created
+		var eprivs string
+		err := tx.QueryRow(b.db.rebind(`SELECT privileges FROM privileges WHERE name = $1;`), name).Scan(&eprivs)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			return err
+		}
+
+		p := decodePrivs(eprivs)
+		for priv, has := range privs {
+			if has {
+				p[priv] = true
+			}
+		}
+
+		_, err = tx.Exec(b.db.rebind(`INSERT INTO privileges (
+	name,
+	privileges
+) VALUES (
+	$1,
+	$2
+) ON CONFLICT (name) DO UPDATE SET privileges = excluded.privileges;`), name, encodePrivs(p))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Password returns the SRP tokens of a user
+func (b *SQLAuthBackend) Password(name string) ([]byte, []byte, error) {
+	var pwd string
+	err := b.db.QueryRow(`SELECT password FROM auth WHERE name = $1;`, name).Scan(&pwd)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, err
+	}
+
+	if pwd == "" {
+		return nil, nil, nil
+	}
+
+	salt, verifier, err := decodeVerifierAndSalt(pwd)
+	return verifier, salt, err
+}
+
+// SetPassword changes the SRP tokens of a user
+func (b *SQLAuthBackend) SetPassword(name string, verifier, salt []byte) error {
+	pwd := encodeVerifierAndSalt(salt, verifier)
+
+	_, err := b.db.Exec(`UPDATE auth SET password = $1 WHERE name = $2;`, pwd, name)
+	return err
+}
+
+// FindUser returns the name of an account whose name equals name ignoring case
+func (b *SQLAuthBackend) FindUser(name string) (string, error) {
+	var r string
+	err := b.db.QueryRow(`SELECT name FROM auth WHERE LOWER(name) = LOWER($1) ORDER BY name LIMIT 1;`, name).Scan(&r)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	return r, nil
+}
+
+// DeleteUser removes an account, its privileges and its roles
+func (b *SQLAuthBackend) DeleteUser(name string) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(b.db.rebind(`DELETE FROM auth WHERE name = $1;`), name); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(b.db.rebind(`DELETE FROM privileges WHERE name = $1;`), name); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(b.db.rebind(`DELETE FROM roles WHERE name = $1;`), name); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RenameUser moves an account, its privileges, its roles, its bans
+// and its mute to a new name
+// Privileges and roles that are stored for the new name are replaced
+func (b *SQLAuthBackend) RenameUser(name, newName string) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"privileges", "roles"} {
+		if _, err := tx.Exec(b.db.rebind(`DELETE FROM `+table+` WHERE name = $1;`), newName); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(b.db.rebind(`UPDATE auth SET name = $1, name_lower = $2 WHERE name = $3;`), newName, strings.ToLower(newName), name)
+	if err != nil {
+		tx.Rollback()
+
+		if isUniqueViolation(err) {
+			return ErrUserExists
+		}
+
+		return err
+	}
+
+	for _, table := range []string{"privileges", "roles", "ban", "name_ban", "mute"} {
+		_, err := tx.Exec(b.db.rebind(`UPDATE `+table+` SET name = $1 WHERE name = $2;`), newName, name)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UserList returns the names of all accounts
+func (b *SQLAuthBackend) UserList() ([]string, error) {
+	rows, err := b.db.Query(`SELECT name FROM auth ORDER BY name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var r []string
+
+	for rows.Next() {
+		var name string
+
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		r = append(r, name)
+	}
+
+	return r, rows.Err()
+}
+
+// Activity returns the activity record of an account
+func (b *SQLAuthBackend) Activity(name string) (*Activity, error) {
+	var first, last sql.NullInt64
+	var addr sql.NullString
+	var playtime int64
+
+	err := b.db.QueryRow(`SELECT first_login, last_login, last_addr, playtime FROM auth WHERE name = $1;`, name).Scan(&first, &last, &addr, &playtime)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	a := &Activity{
+		LastAddr: addr.String,
+		Playtime: time.Duration(playtime) * time.Second,
+	}
+
+	if first.Valid {
+		a.FirstLogin = time.Unix(first.Int64, 0)
+	}
+
+	if last.Valid {
+		a.LastLogin = time.Unix(last.Int64, 0)
+	}
+
+	return a, nil
+}
+
+// SetActivity replaces the activity record of an account
+func (b *SQLAuthBackend) SetActivity(name string, a *Activity) error {
+	var first, last sql.NullInt64
+	if !a.FirstLogin.IsZero() {
+		first = sql.NullInt64{Int64: a.FirstLogin.Unix(), Valid: true}
+	}
+
+	if !a.LastLogin.IsZero() {
+		last = sql.NullInt64{Int64: a.LastLogin.Unix(), Valid: true}
+	}
+
+	addr := sql.NullString{String: a.LastAddr, Valid: a.LastAddr != ""}
+
+	_, err := b.db.Exec(`UPDATE auth SET
+	first_login = $1,
+	last_login = $2,
+	last_addr = $3,
+	playtime = $4
+WHERE name = $5;`, first, last, addr, int64(a.Playtime/time.Second), name)
+	return err
+}
+
+// RecordLogin sets the last login of an account
+// and the first login if it is unknown
+func (b *SQLAuthBackend) RecordLogin(name, addr string, t time.Time) error {
+	_, err := b.db.Exec(`UPDATE auth SET
+	first_login = COALESCE(first_login, $1),
+	last_login = $2,
+	last_addr = $3
+WHERE name = $4;`, t.Unix(), t.Unix(), addr, name)
+	return err
+}
+
+// AddPlaytime adds to the playtime of an account
+func (b *SQLAuthBackend) AddPlaytime(name string, d time.Duration) error {
+	_, err := b.db.Exec(`UPDATE auth SET playtime = playtime + $1 WHERE name = $2;`, int64(d/time.Second), name)
+	return err
+}
+
+// Privs returns the privileges of a player
+func (b *SQLAuthBackend) Privs(name string) (map[string]bool, error) {
+	var eprivs string
+	err := b.db.QueryRow(`SELECT privileges FROM privileges WHERE name = $1;`, name).Scan(&eprivs)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return make(map[string]bool), err
+	}
+
+	return decodePrivs(eprivs), nil
+}
+
+// SetPrivs sets the privileges of a player
+func (b *SQLAuthBackend) SetPrivs(name string, privs map[string]bool) error {
+	_, err := b.db.Exec(`INSERT INTO privileges (
+	name,
+	privileges
+) VALUES (
+	$1,
+	$2
+) ON CONFLICT (name) DO UPDATE SET privileges = excluded.privileges;`, name, encodePrivs(privs))
+	return err
+}
+
+// PrivsList returns the privileges of all players
+func (b *SQLAuthBackend) PrivsList() (map[string]map[string]bool, error) {
+	rows, err := b.db.Query(`SELECT name, privileges FROM privileges;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := make(map[string]map[string]bool)
+
+	for rows.Next() {
+		var name, eprivs string
+
+		if err = rows.Scan(&name, &eprivs); err != nil {
+			return nil, err
+		}
+
+		r[name] = decodePrivs(eprivs)
+	}
+
+	return r, rows.Err()
+}
+
+// Roles returns the roles of a player
+func (b *SQLAuthBackend) Roles(name string) (map[string]bool, error) {
+	var eroles string
+	err := b.db.QueryRow(`SELECT roles FROM roles WHERE name = $1;`, name).Scan(&eroles)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return make(map[string]bool), err
+	}
+
+	return decodePrivs(eroles), nil
+}
+
+// SetRoles sets the roles of a player
+func (b *SQLAuthBackend) SetRoles(name string, roles map[string]bool) error {
+	_, err := b.db.Exec(`INSERT INTO roles (
+	name,
+	roles
+) VALUES (
+	$1,
+	$2
+) ON CONFLICT (name) DO UPDATE SET roles = excluded.roles;`, name, encodePrivs(roles))
+	return err
+}
+
+// RolesList returns the roles of all players
+func (b *SQLAuthBackend) RolesList() (map[string]map[string]bool, error) {
+	rows, err := b.db.Query(`SELECT name, roles FROM roles;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := make(map[string]map[string]bool)
+
+	for rows.Next() {
+		var name, eroles string
+
+		if err = rows.Scan(&name, &eroles); err != nil {
+			return nil, err
+		}
+
+		if roles := decodePrivs(eroles); len(roles) > 0 {
+			r[name] = roles
+		}
+	}
+
+	return r, rows.Err()
+}
+
+// Whitelist returns the names on the whitelist
+func (b *SQLAuthBackend) Whitelist() ([]string, error) {
+	rows, err := b.db.Query(`SELECT name FROM whitelist ORDER BY name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var r []string
+
+	for rows.Next() {
+		var name string
+
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		r = append(r, name)
+	}
+
+	return r, rows.Err()
+}
+
+// IsWhitelisted reports whether a name is on the whitelist ignoring case
+func (b *SQLAuthBackend) IsWhitelisted(name string) (bool, error) {
+	var r string
+	err := b.db.QueryRow(`SELECT name FROM whitelist WHERE LOWER(name) = LOWER($1) LIMIT 1;`, name).Scan(&r)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	return r != "", nil
+}
+
+// WhitelistAdd adds a name to the whitelist
+func (b *SQLAuthBackend) WhitelistAdd(name string) error {
+	_, err := b.db.Exec(`INSERT INTO whitelist (
+	name
+) VALUES (
+	$1
+) ON CONFLICT (name) DO NOTHING;`, name)
+	return err
+}
+
+// WhitelistRemove removes a name from the whitelist
+func (b *SQLAuthBackend) WhitelistRemove(name string) error {
+	_, err := b.db.Exec(`DELETE FROM whitelist WHERE LOWER(name) = LOWER($1);`, name)
+	return err
+}
+
+const banColumns = `addr, name, reason, issuer, created, expires`
+
+// scanBan reads a BanEntry from a row of the ban table
+func scanBan(row interface{ Scan(...interface{}) error }) (*BanEntry, error) {
+	var created, expires sql.NullInt64
+	e := &BanEntry{}
+
+	if err := row.Scan(&e.Addr, &e.Name, &e.Reason, &e.Issuer, &created, &expires); err != nil {
+		return nil, err
+	}
+
+	e.Created = timeOrNone(created.Int64)
+	e.Expires = timeOrNone(expires.Int64)
+
+	return e, nil
+}
+
+func nullUnix(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+// Bans returns the bans that have not expired
+func (b *SQLAuthBackend) Bans() ([]BanEntry, error) {
+	rows, err := b.db.Query(`SELECT `+banColumns+` FROM ban
+WHERE expires IS NULL OR expires > $1
+ORDER BY addr;`, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var r []BanEntry
+
+	for rows.Next() {
+		e, err := scanBan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, *e)
+	}
+
+	return r, rows.Err()
+}
+
+// FindBan returns the ban of an IP address if it has not expired
+func (b *SQLAuthBackend) FindBan(addr string) (*BanEntry, error) {
+	row := b.db.QueryRow(`SELECT `+banColumns+` FROM ban
+WHERE addr = $1 AND (expires IS NULL OR expires > $2);`, addr, time.Now().Unix())
+
+	e, err := scanBan(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return e, err
+}
+
+// Ban adds an entry to the ban list
+// An existing entry of the same address is replaced
+func (b *SQLAuthBackend) Ban(e *BanEntry) error {
+	_, err := b.db.Exec(`INSERT INTO ban (
+	addr,
+	name,
+	reason,
+	issuer,
+	created,
+	expires
+) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+) ON CONFLICT (addr) DO UPDATE SET
+	name = excluded.name,
+	reason = excluded.reason,
+	issuer = excluded.issuer,
+	created = excluded.created,
+	expires = excluded.expires;`, e.Addr, e.Name, e.Reason, e.Issuer, nullUnix(e.Created), nullUnix(e.Expires))
+	return err
+}
+
+// Unban removes a player from the ban list
+func (b *SQLAuthBackend) Unban(id string) error {
+	_, err := b.db.Exec(`DELETE FROM ban WHERE name = $1 OR addr = $2;`, id, id)
+	return err
+}
+
+// nameBanColumns selects the columns of the name_ban table
+// in the order of banColumns
+const nameBanColumns = `'', name, reason, issuer, created, expires`
+
+// NameBans returns the account bans that have not expired
+func (b *SQLAuthBackend) NameBans() ([]BanEntry, error) {
+	rows, err := b.db.Query(`SELECT `+nameBanColumns+` FROM name_ban
+WHERE expires IS NULL OR expires > $1
+ORDER BY name;`, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var r []BanEntry
+
+	for rows.Next() {
+		e, err := scanBan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, *e)
+	}
+
+	return r, rows.Err()
+}
+
+// FindNameBan returns the ban of an account if it has not expired
+func (b *SQLAuthBackend) FindNameBan(name string) (*BanEntry, error) {
+	row := b.db.QueryRow(`SELECT `+nameBanColumns+` FROM name_ban
+WHERE LOWER(name) = LOWER($1) AND (expires IS NULL OR expires > $2);`, name, time.Now().Unix())
+
+	e, err := scanBan(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return e, err
+}
+
+// BanName adds an account ban
+// An existing ban of the same name ignoring case is replaced
+func (b *SQLAuthBackend) BanName(e *BanEntry) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(b.db.rebind(`DELETE FROM name_ban WHERE LOWER(name) = LOWER($1);`), e.Name); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(b.db.rebind(`INSERT INTO name_ban (
+	name,
+	reason,
+	issuer,
+	created,
+	expires
+) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+);`), e.Name, e.Reason, e.Issuer, nullUnix(e.Created), nullUnix(e.Expires))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnbanName removes the ban of an account
+func (b *SQLAuthBackend) UnbanName(name string) error {
+	_, err := b.db.Exec(`DELETE FROM name_ban WHERE LOWER(name) = LOWER($1);`, name)
+	return err
+}
+
+// scanMute reads a Mute from a row of the mute table
+func scanMute(row interface{ Scan(...interface{}) error }) (*Mute, error) {
+	var created, expires sql.NullInt64
+	m := &Mute{}
+
+	if err := row.Scan(&m.Name, &m.Reason, &m.Issuer, &created, &expires); err != nil {
+		return nil, err
+	}
+
+	m.Created = timeOrNone(created.Int64)
+	m.Expires = timeOrNone(expires.Int64)
+
+	return m, nil
+}
+
+// Mutes returns the mutes that have not expired
+func (b *SQLAuthBackend) Mutes() ([]Mute, error) {
+	rows, err := b.db.Query(`SELECT name, reason, issuer, created, expires FROM mute
+WHERE expires IS NULL OR expires > $1
+ORDER BY name;`, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var r []Mute
+
+	for rows.Next() {
+		m, err := scanMute(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, *m)
+	}
+
+	return r, rows.Err()
+}
+
+// FindMute returns the mute of a player if it has not expired
+func (b *SQLAuthBackend) FindMute(name string) (*Mute, error) {
+	row := b.db.QueryRow(`SELECT name, reason, issuer, created, expires FROM mute
+WHERE LOWER(name) = LOWER($1) AND (expires IS NULL OR expires > $2);`, name, time.Now().Unix())
+
+	m, err := scanMute(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return m, err
+}
+
+// Mute adds a mute
+// An existing mute of the same name ignoring case is replaced
+func (b *SQLAuthBackend) Mute(m *Mute) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(b.db.rebind(`DELETE FROM mute WHERE LOWER(name) = LOWER($1);`), m.Name); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(b.db.rebind(`INSERT INTO mute (
+	name,
+	reason,
+	issuer,
+	created,
+	expires
+) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+);`), m.Name, m.Reason, m.Issuer, nullUnix(m.Created), nullUnix(m.Expires))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Unmute removes the mute of a player
+func (b *SQLAuthBackend) Unmute(name string) error {
+	_, err := b.db.Exec(`DELETE FROM mute WHERE LOWER(name) = LOWER($1);`, name)
+	return err
+}
+
+// Audit appends an entry to the audit log
+func (b *SQLAuthBackend) Audit(e *AuditEntry) error {
+	_, err := b.db.Exec(`INSERT INTO audit (
+	created,
+	actor,
+	action,
+	target,
+	args
+) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+);`, e.Time.Unix(), e.Actor, e.Action, e.Target, e.Args)
+	return err
+}
+
+// AuditLog returns the latest entries of the audit log
+// issued by or affecting a player
+func (b *SQLAuthBackend) AuditLog(name string, limit int) ([]AuditEntry, error) {
+	var rows *sql.Rows
+	var err error
+
+	if name == "" {
+		rows, err = b.db.Query(`SELECT id, created, actor, action, target, args FROM audit
+ORDER BY id DESC LIMIT $1;`, limit)
+	} else {
+		rows, err = b.db.Query(`SELECT id, created, actor, action, target, args FROM audit
+WHERE LOWER(actor) = LOWER($1) OR LOWER(target) = LOWER($2)
+ORDER BY id DESC LIMIT $3;`, name, name, limit)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var r []AuditEntry
+
+	for rows.Next() {
+		var e AuditEntry
+		var created int64
+
+		if err = rows.Scan(&e.ID, &created, &e.Actor, &e.Action, &e.Target, &e.Args); err != nil {
+			return nil, err
+		}
+
+		e.Time = time.Unix(created, 0)
+		r = append(r, e)
+	}
+
+	return r, rows.Err()
+}
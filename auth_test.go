@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testAuthBackend(t *testing.T, b AuthBackend) {
+	verifier, salt := []byte("verifier"), []byte("salt")
+
+	if err := b.CreateUser("Bob", verifier, salt, privs("interact", "shout")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Bob", "bob"} {
+		if err := b.CreateUser(name, verifier, salt, nil); !errors.Is(err, ErrUserExists) {
+			t.Fatalf("CreateUser(%s) with existing account Bob = %v", name, err)
+		}
+	}
+
+	v, s, err := b.Password("Bob")
+	if err != nil || !bytes.Equal(v, verifier) || !bytes.Equal(s, salt) {
+		t.Fatalf("Password(Bob) = %q, %q, %v", v, s, err)
+	}
+
+	if v, s, err := b.Password("alice"); err != nil || v != nil || s != nil {
+		t.Fatalf("Password(alice) = %q, %q, %v", v, s, err)
+	}
+
+	if name, err := b.FindUser("bOB"); err != nil || name != "Bob" {
+		t.Fatalf("FindUser(bOB) = %q, %v", name, err)
+	}
+
+	p, err := b.Privs("Bob")
+	if err != nil || len(p) != 2 || !p["interact"] || !p["shout"] {
+		t.Fatalf("Privs(Bob) = %v, %v", p, err)
+	}
+
+	if err := b.SetRoles("Bob", privs("moderator")); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+
+	if err := b.BanName(&BanEntry{Name: "Bob", Reason: "spam", Issuer: "console", Created: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ban, err := b.FindNameBan("bob"); err != nil || ban == nil || ban.Reason != "spam" {
+		t.Fatalf("FindNameBan(bob) = %v, %v", ban, err)
+	}
+
+	if err := b.Mute(&Mute{Name: "Bob", Issuer: "console", Created: now, Expires: now.Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if m, err := b.FindMute("Bob"); err != nil || m != nil {
+		t.Fatalf("FindMute(Bob) returned an expired mute: %v, %v", m, err)
+	}
+
+	for i, addr := range []string{"192.0.2.1", "192.0.2.2"} {
+		if err := b.RecordLogin("Bob", addr, now.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.AddPlaytime("Bob", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if a, err := b.Activity("Bob"); err != nil || a == nil || !a.FirstLogin.Equal(now) || !a.LastLogin.Equal(now.Add(time.Hour)) ||
+		a.LastAddr != "192.0.2.2" || a.Playtime != 2*time.Minute {
+		t.Fatalf("Activity(Bob) = %+v, %v", a, err)
+	}
+
+	if err := b.RenameUser("Bob", "Robert"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _, err := b.Password("Bob"); err != nil || v != nil {
+		t.Fatalf("Password(Bob) after rename = %q, %v", v, err)
+	}
+
+	if p, err := b.Privs("Robert"); err != nil || !p["interact"] {
+		t.Fatalf("Privs(Robert) = %v, %v", p, err)
+	}
+
+	if r, err := b.Roles("Robert"); err != nil || !r["moderator"] {
+		t.Fatalf("Roles(Robert) = %v, %v", r, err)
+	}
+
+	if ban, err := b.FindNameBan("Robert"); err != nil || ban == nil {
+		t.Fatalf("FindNameBan(Robert) = %v, %v", ban, err)
+	}
+
+	if err := b.Ban(&BanEntry{Addr: "192.0.2.1", Name: "Robert", Created: now, Expires: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ban, err := b.FindBan("192.0.2.1"); err != nil || ban == nil || ban.Name != "Robert" || !ban.Expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("FindBan(192.0.2.1) = %v, %v", ban, err)
+	}
+
+	if err := b.Unban("Robert"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ban, err := b.FindBan("192.0.2.1"); err != nil || ban != nil {
+		t.Fatalf("FindBan(192.0.2.1) after unban = %v, %v", ban, err)
+	}
+
+	if err := b.WhitelistAdd("Robert"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := b.IsWhitelisted("robert"); err != nil || !ok {
+		t.Fatalf("IsWhitelisted(robert) = %v, %v", ok, err)
+	}
+
+	if err := b.Audit(&AuditEntry{Time: now, Actor: "console", Action: "ban", Target: "Robert"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if log, err := b.AuditLog("robert", 10); err != nil || len(log) != 1 || log[0].Action != "ban" {
+		t.Fatalf("AuditLog(robert) = %v, %v", log, err)
+	}
+
+	if err := b.DeleteUser("Robert"); err != nil {
+		t.Fatal(err)
+	}
+
+	if users, err := b.UserList(); err != nil || len(users) != 0 {
+		t.Fatalf("UserList() after delete = %v, %v", users, err)
+	}
+
+	if p, err := b.Privs("Robert"); err != nil || len(p) != 0 {
+		t.Fatalf("Privs(Robert) after delete = %v, %v", p, err)
+	}
+}
+
+func TestMemAuthBackend(t *testing.T) {
+	testAuthBackend(t, NewMemAuthBackend())
+}
+
+func TestSQLAuthBackend(t *testing.T) {
+	testAuthBackend(t, NewSQLAuthBackend(testSQLite3(t, "auth", authMigrations)))
+}
+
+func TestAuthMigrationCollisions(t *testing.T) {
+	db := testSQLite3(t, "auth", authMigrations[:10])
+
+	for name, first := range map[string]sql.NullInt64{
+		"Bob":   {},
+		"bob":   {Int64: 1, Valid: true},
+		"alice": {},
+	} {
+		if _, err := db.Exec(`INSERT INTO auth (name, password, first_login) VALUES ($1, '', $2);`, name, first); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Migrate("auth", authMigrations); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewSQLAuthBackend(db)
+
+	for _, name := range []string{"Alice", "BOB"} {
+		if err := b.CreateUser(name, nil, nil, nil); !errors.Is(err, ErrUserExists) {
+			t.Fatalf("CreateUser(%s) with an existing account = %v", name, err)
+		}
+	}
+
+	var lower sql.NullString
+	if err := db.QueryRow(`SELECT name_lower FROM auth WHERE name = $1;`, "bob").Scan(&lower); err != nil || lower.String != "bob" {
+		t.Fatalf("name_lower of bob = %v, %v, want the account that logged in first to keep the name", lower, err)
+	}
+
+	if err := b.RenameUser("bob", "Robert"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.RenameUser("Bob", "ROBERT"); !errors.Is(err, ErrUserExists) {
+		t.Fatalf("RenameUser(Bob, ROBERT) with existing account Robert = %v", err)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/HimbeerserverDE/srp"
+)
+
+var errLegacyPassword = errors.New("legacy password hash can't be converted to SRP")
+
+// A minetestAccount is an entry of a minetest auth database
+type minetestAccount struct {
+	name     string
+	password string
+	privs    []string
+}
+
+// An AuthImportReport describes the result of ImportAuth
+type AuthImportReport struct {
+	// Imported lists the accounts that have been created
+	Imported []string
+	// Conflicts lists the accounts that already existed,
+	// possibly with a name that only differs in case
+	// Their passwords have been left unchanged
+	// and the imported privileges have been added to theirs
+	Conflicts []string
+	// Skipped maps accounts that couldn't be imported to the reason
+	Skipped map[string]string
+}
+
+// String formats the report for humans
+func (r *AuthImportReport) String() string {
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, "Imported %d accounts", len(r.Imported))
+
+	if len(r.Conflicts) > 0 {
+		fmt.Fprintf(b, "\n%d accounts already exist, their passwords have not been changed and the privileges have been added: %s",
+			len(r.Conflicts), strings.Join(r.Conflicts, ", "))
+	}
+
+	var skipped []string
+	for name := range r.Skipped {
+		skipped = append(skipped, name)
+	}
+	sort.Strings(skipped)
+
+	for _, name := range skipped {
+		fmt.Fprintf(b, "\nSkipped %s: %s", name, r.Skipped[name])
+	}
+
+	return b.String()
+}
+
+// isSQLite3File reports whether path starts with the SQLite3 file header
+func isSQLite3File(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	n, _ := f.Read(header)
+
+	return bytes.Equal(header[:n], []byte("SQLite format 3\x00")), nil
+}
+
+// readMinetestAuthSQLite3 reads the auth and user_privileges tables
+// of a minetest auth.sqlite database
+func readMinetestAuthSQLite3(path string) ([]minetestAccount, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	privs := make(map[int64][]string)
+
+	rows, err := db.Query(`SELECT id, privilege FROM user_privileges;`)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+		var priv string
+
+		if err := rows.Scan(&id, &priv); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		privs[id] = append(privs[id], priv)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT id, name, password FROM auth;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var r []minetestAccount
+	for rows.Next() {
+		var id int64
+		var acc minetestAccount
+
+		if err := rows.Scan(&id, &acc.name, &acc.password); err != nil {
+			return nil, err
+		}
+
+		acc.privs = privs[id]
+		r = append(r, acc)
+	}
+
+	return r, rows.Err()
+}
+
+// readMinetestAuthTxt reads a legacy minetest auth.txt file
+// Every line has the format name:password:privs:last_login
+func readMinetestAuthTxt(path string) ([]minetestAccount, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r []minetestAccount
+
+	s := bufio.NewScanner(f)
+	for i := 1; s.Scan(); i++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, ":")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("%s:%d: invalid line", path, i)
+		}
+
+		acc := minetestAccount{
+			name:     parts[0],
+			password: parts[1],
+		}
+
+		for _, priv := range strings.Split(parts[2], ",") {
+			if priv = strings.TrimSpace(priv); priv != "" {
+				acc.privs = append(acc.privs, priv)
+			}
+		}
+
+		r = append(r, acc)
+	}
+
+	return r, s.Err()
+}
+
+func decodeMinetestBase64(s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return base64.RawStdEncoding.DecodeString(s)
+	}
+
+	return b, nil
+}
+
+// convertMinetestPassword returns the SRP verifier and salt
+// of a minetest password entry
+// Entries have the format #1#salt#verifier,
+// empty passwords are converted to SRP tokens of the empty password
+func convertMinetestPassword(name, pwd string) ([]byte, []byte, error) {
+	if pwd == "" {
+		salt, verifier, err := srp.NewClient([]byte(strings.ToLower(name)), []byte(""))
+		return verifier, salt, err
+	}
+
+	if !strings.HasPrefix(pwd, "#1#") {
+		return nil, nil, errLegacyPassword
+	}
+
+	parts := strings.Split(strings.TrimPrefix(pwd, "#1#"), "#")
+	if len(parts) != 2 {
+		return nil, nil, errors.New("invalid SRP password entry")
+	}
+
+	salt, err := decodeMinetestBase64(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verifier, err := decodeMinetestBase64(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return verifier, salt, nil
+}
+
+// addImportedPrivs adds privileges to the privileges of a player
+func addImportedPrivs(name string, ps []string) error {
+	if len(ps) == 0 {
+		return nil
+	}
+
+	privs, err := Auth().Privs(name)
+	if err != nil {
+		return err
+	}
+
+	for _, priv := range ps {
+		privs[priv] = true
+	}
+
+	return Auth().SetPrivs(name, privs)
+}
+
+// ImportAuth imports the accounts and privileges of a minetest
+// auth.sqlite or auth.txt database into the auth backend
+// The passwords of accounts that already exist are not changed,
+// the privileges are added to theirs
+func ImportAuth(path string) (*AuthImportReport, error) {
+	sqlite3, err := isSQLite3File(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []minetestAccount
+	if sqlite3 {
+		accounts, err = readMinetestAuthSQLite3(path)
+	} else {
+		accounts, err = readMinetestAuthTxt(path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := &AuthImportReport{Skipped: make(map[string]string)}
+
+	for _, acc := range accounts {
+		existing, err := Auth().FindUser(acc.name)
+		if err != nil {
+			return r, err
+		}
+
+		if existing != "" {
+			if err := addImportedPrivs(existing, acc.privs); err != nil {
+				return r, err
+			}
+
+			if existing == acc.name {
+				r.Conflicts = append(r.Conflicts, acc.name)
+			} else {
+				r.Conflicts = append(r.Conflicts, acc.name+" (as "+existing+")")
+			}
+
+			continue
+		}
+
+		verifier, salt, err := convertMinetestPassword(acc.name, acc.password)
+		if err != nil {
+			r.Skipped[acc.name] = err.Error()
+			continue
+		}
+
+		if err := Auth().CreateUser(acc.name, verifier, salt, nil); err != nil {
+			return r, err
+		}
+
+		if err := addImportedPrivs(acc.name, acc.privs); err != nil {
+			return r, err
+		}
+
+		r.Imported = append(r.Imported, acc.name)
+	}
+
+	return r, nil
+}
+
+func init() {
+	subcommands["import-auth"] = subcommand{
+		usage: "<auth.sqlite|auth.txt>",
+		help:  "Import the accounts and privileges of a minetest auth database",
+		fn: func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: import-auth <auth.sqlite|auth.txt>")
+			}
+
+			r, err := ImportAuth(args[0])
+			if r != nil {
+				fmt.Println(r)
+			}
+
+			return err
+		},
+	}
+}
@@ -1,64 +1,181 @@
 package main
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"net"
-
-	_ "github.com/mattn/go-sqlite3"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var ErrInvalidAddress = errors.New("invalid ip address format")
+var ErrInvalidDuration = errors.New("invalid duration")
+
+// A BanEntry is an entry of the ban list
+// Addr is empty for account bans
+type BanEntry struct {
+	Addr   string
+	Name   string
+	Reason string
+	// Issuer is the player, console or RPC server that created the ban
+	Issuer  string
+	Created time.Time
+	// Expires is zero if the ban is permanent
+	Expires time.Time
+}
+
+// Expired reports whether a temporary ban is over
+func (b *BanEntry) Expired() bool {
+	return !b.Expires.IsZero() && !time.Now().Before(b.Expires)
+}
+
+// Message returns the reason shown to a banned client
+func (b *BanEntry) Message() string {
+	msg := "You are banned"
+	if b.Addr == "" {
+		msg = "This account is banned"
+	}
+
+	if !b.Expires.IsZero() {
+		msg += " for another " + formatDuration(time.Until(b.Expires))
+	}
+	msg += "."
+
+	if b.Reason != "" {
+		msg += " Reason: " + b.Reason
+	}
+
+	return msg
+}
+
+var durationRegexp = regexp.MustCompile(`^([0-9]+[smhdw])+$`)
+var durationPartRegexp = regexp.MustCompile(`[0-9]+[smhdw]`)
+
+// parseDuration parses durations like 30m, 12h or 1w2d
+// Supported units are s, m, h, d (days) and w (weeks)
+func parseDuration(s string) (time.Duration, error) {
+	if !durationRegexp.MatchString(s) {
+		return 0, ErrInvalidDuration
+	}
+
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+
+	var d time.Duration
+	for _, part := range durationPartRegexp.FindAllString(s, -1) {
+		n, err := strconv.ParseInt(part[:len(part)-1], 10, 64)
+		if err != nil {
+			return 0, ErrInvalidDuration
+		}
+
+		// Reject durations that don't fit into a time.Duration
+		unit := units[part[len(part)-1]]
+		if n > int64(math.MaxInt64/unit) || time.Duration(n)*unit > math.MaxInt64-d {
+			return 0, ErrInvalidDuration
+		}
+
+		d += time.Duration(n) * unit
+	}
+
+	if d <= 0 {
+		return 0, ErrInvalidDuration
+	}
+
+	return d, nil
+}
+
+// formatDuration formats a duration in days, hours, minutes and seconds
+// leaving out units that are zero, e.g. 1d2h or 30m
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Second {
+		d = time.Second
+	}
+
+	var r string
+	for _, u := range []struct {
+		suffix string
+		d      time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	} {
+		if n := d / u.d; n > 0 {
+			r += strconv.Itoa(int(n)) + u.suffix
+			d -= n * u.d
+		}
+	}
+
+	return r
+}
 
 // BanList returns the list of banned players and IP addresses
 func BanList() (map[string]string, error) {
-	db, err := authDB()
+	bans, err := Auth().Bans()
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
 
-	rows, err := db.Query(`SELECT addr, name FROM ban;`)
-	if err != nil {
-		return nil, err
+	r := make(map[string]string)
+	for _, b := range bans {
+		r[b.Addr] = b.Name
 	}
 
-	r := make(map[string]string)
+	return r, nil
+}
 
-	for rows.Next() {
-		var addr, name string
+// FindBan returns the ban of an IP address or of a range
+// containing it, nil if it isn't banned
+func FindBan(addr string) (*BanEntry, error) {
+	if ip := net.ParseIP(addr); ip != nil {
+		addr = ip.String()
+	}
 
-		if err = rows.Scan(&addr, &name); err != nil {
-			return nil, err
-		}
+	b, err := Auth().FindBan(addr)
+	if err != nil || b != nil {
+		return b, err
+	}
 
-		r[addr] = name
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, nil
 	}
 
-	return r, nil
+	return findRangeBan(ip)
+}
+
+// FindBan returns the ban of a Conn, nil if it isn't banned
+func (c *Conn) FindBan() (*BanEntry, error) {
+	return FindBan(c.IP().String())
 }
 
 // IsBanned reports whether an IP address is banned
 func IsBanned(addr string) (bool, string, error) {
-	db, err := authDB()
+	b, err := FindBan(addr)
 	if err != nil {
 		return true, "", err
 	}
-	defer db.Close()
 
-	var name string
-	err = db.QueryRow(`SELECT name FROM ban WHERE addr = $1;`, addr).Scan(&name)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return true, "", err
+	if b == nil {
+		return false, "", nil
 	}
 
-	return name != "", name, nil
+	return true, b.Name, nil
 }
 
 // IsBanned reports whether a Conn is banned
 func (c *Conn) IsBanned() (bool, string, error) {
-	addr := c.Addr().(*net.UDPAddr).IP.String()
+	addr := c.IP().String()
 
 	banned, name, err := IsBanned(addr)
 	if err != nil {
@@ -68,56 +185,225 @@ func (c *Conn) IsBanned() (bool, string, error) {
 	return banned, name, nil
 }
 
-// Ban adds an IP address to the ban list
-func Ban(addr, name string) error {
-	db, err := authDB()
+// AddBan adds an entry to the ban list
+// Addr is an IP address or a CIDR range
+// Created is set to the current time if it is zero
+func AddBan(b *BanEntry) error {
+	addr, n, err := parseBanAddr(b.Addr)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	b.Addr = addr
+
+	existing, err := FindBan(b.Addr)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		return fmt.Errorf("%s is already banned", existing.Addr)
+	}
+
+	if n != nil {
+		// Bans of addresses or ranges inside of a new range are
+		// superseded by it and kept, e.g. if they don't expire
+		existing, err := findCoveringBan(n)
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			return fmt.Errorf("%s is already banned by %s", b.Addr, existing.Addr)
+		}
+	}
+
+	if b.Created.IsZero() {
+		b.Created = time.Now()
+	}
+
+	if err := Auth().Ban(b); err != nil {
+		return err
+	}
 
-	if net.ParseIP(addr) == nil {
-		return ErrInvalidAddress
+	if n != nil {
+		return ReloadRangeBans()
 	}
 
-	_, err = db.Exec(`INSERT INTO ban (
-	addr,
-	name
-) VALUES (
-	$1,
-	$2
-);`, addr, name)
-	return err
+	return nil
 }
 
-// Ban adds a Conn to the ban list
+// Ban adds an IP address to the ban list permanently
+func Ban(addr, name string) error {
+	return AddBan(&BanEntry{Addr: addr, Name: name})
+}
+
+// Ban adds a Conn to the ban list permanently
 func (c *Conn) Ban() error {
-	banned, _, err := c.IsBanned()
-	if err != nil {
+	return c.BanFor(0, "", "")
+}
+
+// BanFor adds a Conn to the ban list and disconnects it
+// A duration of 0 means that the ban is permanent
+func (c *Conn) BanFor(d time.Duration, reason, issuer string) error {
+	b := &BanEntry{
+		Addr:   c.IP().String(),
+		Name:   c.Username(),
+		Reason: reason,
+		Issuer: issuer,
+	}
+
+	if d > 0 {
+		b.Expires = time.Now().Add(d)
+	}
+
+	if err := AddBan(b); err != nil {
 		return err
 	}
 
-	if banned {
-		return fmt.Errorf("ip address %s is already banned", c.Addr().String())
+	c.CloseWith(AccessDeniedCustomString, b.Message(), false)
+	return nil
+}
+
+// banTarget bans a connected player, an IP address or a CIDR range
+// The name of an address ban is the name of a player
+// connected from that address, if there is one
+func banTarget(target string, d time.Duration, reason, issuer string) error {
+	addr, n, err := parseBanAddr(target)
+	if err != nil {
+		c := ConnByUsername(target)
+		if c == nil {
+			return fmt.Errorf("%s is not online", target)
+		}
+
+		return c.BanFor(d, reason, issuer)
 	}
 
-	name := c.Username()
-	addr := c.Addr().(*net.UDPAddr).IP.String()
+	if n == nil {
+		ip := net.ParseIP(addr)
+		n = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+	}
+
+	b := &BanEntry{
+		Addr:   addr,
+		Reason: reason,
+		Issuer: issuer,
+	}
+
+	if d > 0 {
+		b.Expires = time.Now().Add(d)
+	}
+
+	var conns []*Conn
+	for _, c := range Conns() {
+		if n.Contains(c.IP()) {
+			conns = append(conns, c)
+		}
+	}
 
-	Ban(addr, name)
+	if len(conns) > 0 && !strings.Contains(addr, "/") {
+		b.Name = conns[0].Username()
+	}
+
+	if err := AddBan(b); err != nil {
+		return err
+	}
+
+	for _, c := range conns {
+		c.CloseWith(AccessDeniedCustomString, b.Message(), false)
+	}
 
-	c.CloseWith(AccessDeniedCustomString, "Banned.", false)
 	return nil
 }
 
+// parseBanParams splits the parameters of a ban command
+// into the target, an optional duration and the reason
+// A second parameter that starts with a digit must be a valid duration
+// so that a mistyped duration doesn't make the ban permanent
+func parseBanParams(param string) (string, time.Duration, string, error) {
+	params := strings.SplitN(param, " ", 3)
+
+	var d time.Duration
+	var reason string
+
+	if len(params) > 1 {
+		if params[1] != "" && params[1][0] >= '0' && params[1][0] <= '9' {
+			var err error
+			if d, err = parseDuration(params[1]); err != nil {
+				return params[0], 0, "", fmt.Errorf("%w %s", err, params[1])
+			}
+
+			if len(params) > 2 {
+				reason = params[2]
+			}
+		} else {
+			reason = strings.Join(params[1:], " ")
+		}
+	}
+
+	return params[0], d, reason, nil
+}
+
 // Unban removes a player from the ban list
+// id can be an IP address, a CIDR range or a name
 func Unban(id string) error {
-	db, err := authDB()
+	if addr, _, err := parseBanAddr(id); err == nil {
+		id = addr
+	}
+
+	if err := Auth().Unban(id); err != nil {
+		return err
+	}
+
+	return ReloadRangeBans()
+}
+
+// FindNameBan returns the ban of an account, nil if it isn't banned
+func FindNameBan(name string) (*BanEntry, error) {
+	return Auth().FindNameBan(name)
+}
+
+// BanName bans an account independently of the IP address
+// and disconnects the player if it is online
+// A duration of 0 means that the ban is permanent
+func BanName(name string, d time.Duration, reason, issuer string) error {
+	if !ValidPlayerName(name) {
+		return fmt.Errorf("invalid name %s", name)
+	}
+
+	existing, err := FindNameBan(name)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	_, err = db.Exec(`DELETE FROM ban WHERE name = $1 OR addr = $2;`, id, id)
-	return err
+	if existing != nil {
+		return fmt.Errorf("%s is already banned", existing.Name)
+	}
+
+	b := &BanEntry{
+		Name:    name,
+		Reason:  reason,
+		Issuer:  issuer,
+		Created: time.Now(),
+	}
+
+	if d > 0 {
+		b.Expires = b.Created.Add(d)
+	}
+
+	if err := Auth().BanName(b); err != nil {
+		return err
+	}
+
+	for _, c := range Conns() {
+		if strings.EqualFold(c.Username(), name) {
+			c.CloseWith(AccessDeniedCustomString, b.Message(), false)
+		}
+	}
+
+	return nil
+}
+
+// UnbanName removes the ban of an account
+func UnbanName(name string) error {
+	return Auth().UnbanName(name)
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"30m":  30 * time.Minute,
+		"1w2d": 9 * 24 * time.Hour,
+		"1h1s": time.Hour + time.Second,
+	} {
+		if d, err := parseDuration(s); err != nil || d != want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v", s, d, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "0s", "1y", "5", "m", "99999999999999999999s", "15251w", "2562047h2562047h"} {
+		if d, err := parseDuration(s); !errors.Is(err, ErrInvalidDuration) {
+			t.Errorf("parseDuration(%q) = %v, %v, want ErrInvalidDuration", s, d, err)
+		}
+	}
+}
+
+func TestParseBanParams(t *testing.T) {
+	for _, tc := range []struct {
+		param, target string
+		d             time.Duration
+		reason        string
+	}{
+		{"bob", "bob", 0, ""},
+		{"bob 1d", "bob", 24 * time.Hour, ""},
+		{"bob 1d spam in chat", "bob", 24 * time.Hour, "spam in chat"},
+		{"bob spam in chat", "bob", 0, "spam in chat"},
+	} {
+		target, d, reason, err := parseBanParams(tc.param)
+		if err != nil || target != tc.target || d != tc.d || reason != tc.reason {
+			t.Errorf("parseBanParams(%q) = %q, %v, %q, %v", tc.param, target, d, reason, err)
+		}
+	}
+
+	if _, d, _, err := parseBanParams("bob 1y spam"); !errors.Is(err, ErrInvalidDuration) {
+		t.Errorf("parseBanParams(bob 1y spam) = %v, %v, want ErrInvalidDuration", d, err)
+	}
+}
+
+func TestBanRangesCovering(t *testing.T) {
+	r := newBanRanges()
+	for _, s := range []string{"10.1.0.0/16", "2001:db8::/32"} {
+		_, n, _ := net.ParseCIDR(s)
+		r.add(n, BanEntry{Addr: n.String()})
+	}
+
+	for s, want := range map[string]bool{
+		"10.1.0.0/16":         true,
+		"10.1.2.0/24":         true,
+		"10.0.0.0/8":          false,
+		"10.2.0.0/16":         false,
+		"::ffff:10.1.2.0/120": true,
+		"2001:db8:1::/48":     true,
+		"2001:db9::/32":       false,
+	} {
+		_, n, _ := net.ParseCIDR(s)
+		if b := r.covering(n); (b != nil) != want {
+			t.Errorf("covering(%s) = %v, want covered %v", s, b, want)
+		}
+	}
+}
+
+func TestAddBanRange(t *testing.T) {
+	testMemBackends(t)
+	t.Cleanup(func() {
+		rangeBansMu.Lock()
+		rangeBans = nil
+		rangeBansMu.Unlock()
+	})
+
+	for _, tc := range []struct {
+		addr string
+		ok   bool
+	}{
+		{"203.0.113.7", true},
+		{"203.0.113.9", true},
+		{"203.0.113.7", false},
+		// A wider range supersedes the addresses it contains
+		{"203.0.113.0/24", true},
+		{"203.0.113.0/24", false},
+		{"203.0.113.128/25", false},
+		{"203.0.113.10", false},
+		{"203.0.0.0/16", true},
+		{"198.51.100.0/24", true},
+	} {
+		if err := AddBan(&BanEntry{Addr: tc.addr}); (err == nil) != tc.ok {
+			t.Errorf("AddBan(%s) = %v, want success %v", tc.addr, err, tc.ok)
+		}
+	}
+}
+
+func TestBanRangesMatch(t *testing.T) {
+	r := newBanRanges()
+	for _, s := range []string{"10.1.0.0/16", "::ffff:192.0.2.0/120", "2001:db8::/32"} {
+		_, n, _ := net.ParseCIDR(s)
+		r.add(n, BanEntry{Addr: n.String()})
+	}
+
+	_, n, _ := net.ParseCIDR("198.51.100.0/24")
+	r.add(n, BanEntry{Addr: n.String(), Expires: time.Now().Add(-time.Second)})
+
+	for s, want := range map[string]bool{
+		"10.1.2.3":         true,
+		"::ffff:10.1.2.3":  true,
+		"10.2.0.1":         false,
+		"192.0.2.77":       true,
+		"::ffff:192.0.2.1": true,
+		"192.0.3.1":        false,
+		"2001:db8::1":      true,
+		"2001:db9::1":      false,
+		"198.51.100.1":     false,
+	} {
+		if b := r.match(net.ParseIP(s)); (b != nil) != want {
+			t.Errorf("match(%s) = %v, want banned %v", s, b, want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Range bans are CIDR ranges that are banned as a whole
+// They come from the ban list and from the files in ban_files
+// An address is matched by masking it with every prefix length
+// that is in use and looking the network up, so the cost of
+// a lookup doesn't depend on the number of banned ranges
+
+// banRanges is an index of banned CIDR ranges
+type banRanges struct {
+	v4, v6 map[int]map[string]BanEntry
+	// files holds the number of ranges read from every ban file
+	files map[string]int
+}
+
+func newBanRanges() *banRanges {
+	return &banRanges{
+		v4:    make(map[int]map[string]BanEntry),
+		v6:    make(map[int]map[string]BanEntry),
+		files: make(map[string]int),
+	}
+}
+
+func (r *banRanges) nets(ip net.IP) map[int]map[string]BanEntry {
+	if ip.To4() != nil {
+		return r.v4
+	}
+
+	return r.v6
+}
+
+// add adds a range to the index, a range that is already
+// in the index is kept
+func (r *banRanges) add(n *net.IPNet, b BanEntry) {
+	ones, bits := n.Mask.Size()
+
+	ip := n.IP
+	if ip4 := ip.To4(); ip4 != nil && bits == 128 {
+		// IPv4-mapped IPv6 range
+		ip = ip4
+		ones -= 96
+	}
+
+	nets := r.nets(ip)
+	if nets[ones] == nil {
+		nets[ones] = make(map[string]BanEntry)
+	}
+
+	key := ip.String()
+	if _, ok := nets[ones][key]; !ok {
+		nets[ones][key] = b
+	}
+}
+
+// match returns the ban of a range containing ip
+// or nil if there is none
+func (r *banRanges) match(ip net.IP) *BanEntry {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	bits := len(ip) * 8
+	for ones, nets := range r.nets(ip) {
+		b, ok := nets[ip.Mask(net.CIDRMask(ones, bits)).String()]
+		if ok && !b.Expired() {
+			return &b
+		}
+	}
+
+	return nil
+}
+
+// covering returns the ban of a range that contains all of n,
+// e.g. the same range or a wider one, nil if there is none
+func (r *banRanges) covering(n *net.IPNet) *BanEntry {
+	ones, bits := n.Mask.Size()
+
+	ip := n.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		if bits == 128 {
+			// IPv4-mapped IPv6 range
+			ones -= 96
+		}
+
+		ip = ip4
+	}
+
+	for prefix, nets := range r.nets(ip) {
+		if prefix > ones {
+			continue
+		}
+
+		b, ok := nets[ip.Mask(net.CIDRMask(prefix, len(ip)*8)).String()]
+		if ok && !b.Expired() {
+			return &b
+		}
+	}
+
+	return nil
+}
+
+var rangeBans *banRanges
+var rangeBansMu sync.RWMutex
+
+// rangeBansReloadMu serializes reloads so that a slow reload
+// can't replace the index built by a newer one
+var rangeBansReloadMu sync.Mutex
+
+// parseBanAddr parses an IP address or a CIDR range
+// and returns it in canonical form
+func parseBanAddr(s string) (string, *net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String(), nil, nil
+	}
+
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", nil, ErrInvalidAddress
+	}
+
+	return n.String(), n, nil
+}
+
+// ipNet returns the range that only contains ip
+func ipNet(ip net.IP) *net.IPNet {
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 32
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
+
+// readBanFile reads a file containing one IP address or CIDR range
+// per line, empty lines and lines starting with # are ignored
+func readBanFile(path string) ([]*net.IPNet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r []*net.IPNet
+
+	s := bufio.NewScanner(f)
+	for i := 1; s.Scan(); i++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if ip := net.ParseIP(line); ip != nil {
+			r = append(r, ipNet(ip))
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(line)
+		if err != nil {
+			log.Printf("%s:%d: %s", path, i, err)
+			continue
+		}
+
+		r = append(r, n)
+	}
+
+	return r, s.Err()
+}
+
+// ReloadRangeBans rebuilds the index of banned ranges
+// from the ban list and re-reads the ban files
+func ReloadRangeBans() error {
+	rangeBansReloadMu.Lock()
+	defer rangeBansReloadMu.Unlock()
+
+	bans, err := Auth().Bans()
+	if err != nil {
+		return err
+	}
+
+	// Ranges from the ban list take precedence
+	// over ranges from ban files
+	r := newBanRanges()
+	for _, b := range bans {
+		if _, n, err := net.ParseCIDR(b.Addr); err == nil {
+			r.add(n, b)
+		}
+	}
+
+	for _, path := range Conf().BanFiles {
+		nets, err := readBanFile(path)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+
+		for _, n := range nets {
+			r.add(n, BanEntry{Addr: n.String(), Issuer: path})
+		}
+
+		r.files[path] = len(nets)
+	}
+
+	rangeBansMu.Lock()
+	rangeBans = r
+	rangeBansMu.Unlock()
+
+	return nil
+}
+
+// findRangeBan returns the ban of a range containing an IP address
+func findRangeBan(ip net.IP) (*BanEntry, error) {
+	rangeBansMu.RLock()
+	r := rangeBans
+	rangeBansMu.RUnlock()
+
+	if r == nil {
+		if err := ReloadRangeBans(); err != nil {
+			return nil, err
+		}
+
+		return findRangeBan(ip)
+	}
+
+	return r.match(ip), nil
+}
+
+// findCoveringBan returns the ban of a range of the ban list
+// or the ban files that contains all of n, nil if there is none
+func findCoveringBan(n *net.IPNet) (*BanEntry, error) {
+	rangeBansMu.RLock()
+	r := rangeBans
+	rangeBansMu.RUnlock()
+
+	if r == nil {
+		if err := ReloadRangeBans(); err != nil {
+			return nil, err
+		}
+
+		return findCoveringBan(n)
+	}
+
+	return r.covering(n), nil
+}
+
+// BanFiles returns the number of ranges read from every ban file
+func BanFiles() map[string]int {
+	rangeBansMu.RLock()
+	defer rangeBansMu.RUnlock()
+
+	r := make(map[string]int)
+	if rangeBans != nil {
+		for path, n := range rangeBans.files {
+			r[path] = n
+		}
+	}
+
+	return r
+}
+
+var banFileTicker *time.Ticker
+
+// initBanFiles re-reads the ban files periodically
+func initBanFiles() {
+	if err := ReloadRangeBans(); err != nil {
+		log.Print(err)
+	}
+
+	reload := time.NewTicker(time.Duration(Conf().BanFileInterval) * time.Second)
+
+	rangeBansMu.Lock()
+	banFileTicker = reload
+	rangeBansMu.Unlock()
+
+	go func() {
+		for range reload.C {
+			if err := ReloadRangeBans(); err != nil {
+				log.Print(err)
+			}
+		}
+	}()
+}
+
+// resetBanFileInterval applies the ban_file_interval
+// of the current configuration
+func resetBanFileInterval() {
+	rangeBansMu.RLock()
+	defer rangeBansMu.RUnlock()
+
+	if banFileTicker != nil {
+		banFileTicker.Reset(time.Duration(Conf().BanFileInterval) * time.Second)
+	}
+}
@@ -22,6 +22,27 @@ type chatCommand struct {
 }
 
 var chatCommands map[string]chatCommand
+
+// hiddenParamCommands are chat commands whose parameters
+// may contain passwords and must not be logged
+var hiddenParamCommands = map[string]bool{
+	"setpassword": true,
+	"rename":      true,
+}
+
+// scopedCommands are chat commands that act on players or servers
+// and accept privileges scoped to the current server of the player
+// running them, they check the scope of their targets themselves
+// Other commands affect the whole network and require global privileges,
+// this includes bans and mutes which apply on every server
+var scopedCommands = map[string]bool{
+	"send":        true,
+	"sendcurrent": true,
+	"kick":        true,
+	"grant":       true,
+	"revoke":      true,
+}
+
 var onChatMsg []func(*Conn, string) bool
 
 var onServerChatMsg []func(*Conn, string) bool
@@ -68,10 +89,14 @@ func processChatMessage(c *Conn, r *bytes.Reader) bool {
 		s = strings.Replace(s, ChatCommandPrefix, "", 1)
 		params := strings.Split(s, " ")
 
-		log.Print(c.Username(), " issued command: ", s)
+		if hiddenParamCommands[params[0]] {
+			log.Print(c.Username(), " issued command: ", params[0])
+		} else {
+			log.Print(c.Username(), " issued command: ", s)
+		}
 
 		// Priv check
-		allow, err := c.CheckPrivs(chatCommands[params[0]].privs)
+		allow, err := c.checkCommandPrivs(params[0])
 		if err != nil {
 			log.Print(err)
 			return true
@@ -125,6 +150,17 @@ func processChatMessage(c *Conn, r *bytes.Reader) bool {
 		return true
 	} else {
 		// Regular message
+		muted, m, err := c.IsMuted()
+		if err != nil {
+			log.Print(err)
+			return true
+		}
+
+		if muted {
+			c.SendChatMsg(m.Message())
+			return true
+		}
+
 		noforward := false
 		for i := range onChatMsg {
 			if onChatMsg[i](c, s) {
@@ -186,7 +222,7 @@ func ChatSendAll(msg string) {
 
 // Colorize prepends a color escape sequence to a string
 func Colorize(text, color string) string {
-	return string(0x1b) + "(c@" + color + ")" + text + string(0x1b) + "(c@#FFF)"
+	return "\x1b(c@" + color + ")" + text + "\x1b(c@#FFF)"
 }
 
 func narrow(b []byte) []byte {
@@ -217,10 +253,4 @@ func wider(b []byte) []byte {
 
 func init() {
 	chatCommands = make(map[string]chatCommand)
-
-	// Read cmd prefix from config
-	prefix, ok := ConfKey("command_prefix").(string)
-	if ok {
-		ChatCommandPrefix = prefix
-	}
 }
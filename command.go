@@ -123,6 +123,10 @@ func processPktCommand(src, dst *Conn, pkt *rudp.Pkt) bool {
 	r.Read(cmdBytes)
 
 	if src.IsSrv() {
+		if src.processRotation(binary.BigEndian.Uint16(cmdBytes), r) {
+			return true
+		}
+
 		switch cmd := binary.BigEndian.Uint16(cmdBytes); cmd {
 		case ToClientActiveObjectRemoveAdd:
 			pkt.Reader = bytes.NewReader(append(cmdBytes, processAoRmAdd(dst, r)...))
@@ -250,8 +254,7 @@ func processPktCommand(src, dst *Conn, pkt *rudp.Pkt) bool {
 
 			return false
 		case ToClientAccessDenied:
-			doFallback, ok := ConfKey("do_fallback").(bool)
-			if ok && !doFallback {
+			if !Conf().DoFallback {
 				return false
 			}
 
@@ -266,11 +269,7 @@ func processPktCommand(src, dst *Conn, pkt *rudp.Pkt) bool {
 				msg = "crashed"
 			}
 
-			defsrv, ok := ConfKey("default_server").(string)
-			if !ok {
-				log.Print("Default server name not set or not a string")
-				return false
-			}
+			defsrv := dst.ListenerConf().DefaultServer
 
 			if dst.ServerName() == defsrv {
 				return false
@@ -334,6 +333,22 @@ func processPktCommand(src, dst *Conn, pkt *rudp.Pkt) bool {
 			return true
 		case ToServerSRPBytesA:
 			if !src.sudoMode {
+				if locked, _ := src.IsLockedOut(); locked {
+					log.Print("Locked out user " + src.Username() + " at " + src.Addr().String() + " tried to enter sudo mode")
+
+					// Send DENY_SUDO_MODE
+					data := []byte{0, ToClientDenySudoMode}
+
+					ack, err := src.Send(rudp.Pkt{Reader: bytes.NewReader(data)})
+					if err != nil {
+						log.Print(err)
+						return true
+					}
+					<-ack
+
+					return true
+				}
+
 				A := ReadBytes16(r)
 
 				v, s, err := Password(src.Username())
@@ -381,6 +396,8 @@ func processPktCommand(src, dst *Conn, pkt *rudp.Pkt) bool {
 
 				if subtle.ConstantTimeCompare(M, M2) == 1 {
 					// Password is correct
+					src.AuthSucceeded()
+
 					// Enter sudo mode
 					src.sudoMode = true
 
@@ -397,6 +414,8 @@ func processPktCommand(src, dst *Conn, pkt *rudp.Pkt) bool {
 					// Client supplied wrong password
 					log.Print("User " + src.Username() + " at " + src.Addr().String() + " supplied wrong password for sudo mode")
 
+					src.AuthFailed()
+
 					// Send DENY_SUDO_MODE
 					data := []byte{0, ToClientDenySudoMode}
 
@@ -425,8 +444,7 @@ func processPktCommand(src, dst *Conn, pkt *rudp.Pkt) bool {
 				<-ack
 			}
 
-			chAllowed, ok := ConfKey("modchannels").(bool)
-			if ok && !chAllowed {
+			if !Conf().Modchannels {
 				deny()
 				return true
 			}
@@ -455,8 +473,7 @@ func processPktCommand(src, dst *Conn, pkt *rudp.Pkt) bool {
 				<-ack
 			}
 
-			chAllowed, ok := ConfKey("modchannels").(bool)
-			if ok && !chAllowed {
+			if !Conf().Modchannels {
 				deny()
 				return true
 			}
@@ -470,8 +487,7 @@ func processPktCommand(src, dst *Conn, pkt *rudp.Pkt) bool {
 			src.modChs[ch] = false
 			return false
 		case ToServerModChannelMsg:
-			chAllowed, ok := ConfKey("modchannels").(bool)
-			if ok && !chAllowed {
+			if !Conf().Modchannels {
 				return true
 			}
 
@@ -1,13 +1,25 @@
 package main
 
 import (
+	"encoding"
+	"errors"
+	"fmt"
+	"log"
+	"net"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v2"
 )
 
 var config map[interface{}]interface{}
+var conf *Config
+var configMu sync.RWMutex
 
 var defaultConfig []byte = []byte(`servers:
   lobby:
@@ -16,37 +28,643 @@ default_server: lobby
 force_default_server: true
 `)
 
-func loadConfig() error {
-	os.Mkdir("config", 0777)
+// A HostList is a list of addresses the proxy listens on
+// It can be written as a single entry or as a list of entries
+type HostList []ListenerConfig
 
-	_, err := os.Stat("config/multiserver.yml")
-	if os.IsNotExist(err) {
-		os.WriteFile("config/multiserver.yml", defaultConfig, 0666)
+func (h *HostList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var l ListenerConfig
+	if err := unmarshal(&l); err == nil {
+		*h = HostList{l}
+		return nil
 	}
 
-	data, err := os.ReadFile("config/multiserver.yml")
-	if err != nil {
+	var ls []ListenerConfig
+	if err := unmarshal(&ls); err != nil {
 		return err
 	}
 
-	config = make(map[interface{}]interface{})
+	*h = ls
+	return nil
+}
+
+// A ListenerConfig holds the configuration of a single listen address
+// It can be written as the address alone
+// Settings that aren't set are inherited from the top-level configuration
+type ListenerConfig struct {
+	Address              string  `yaml:"address"`
+	PlayerLimit          *int    `yaml:"player_limit"`
+	DefaultServer        *string `yaml:"default_server"`
+	ForceDefaultServer   *bool   `yaml:"force_default_server"`
+	ServerlistURL        *string `yaml:"serverlist_url"`
+	ServerlistAddress    *string `yaml:"serverlist_address"`
+	ServerlistName       *string `yaml:"serverlist_name"`
+	ServerlistDesc       *string `yaml:"serverlist_desc"`
+	ServerlistDisplayURL *string `yaml:"serverlist_display_url"`
+	ServerlistCreative   *bool   `yaml:"serverlist_creative"`
+	ServerlistDamage     *bool   `yaml:"serverlist_damage"`
+	ServerlistPvP        *bool   `yaml:"serverlist_pvp"`
+	ServerlistGame       *string `yaml:"serverlist_game"`
+}
+
+func (l *ListenerConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&l.Address); err == nil {
+		return nil
+	}
+
+	type plain ListenerConfig
+	return unmarshal((*plain)(l))
+}
+
+// UnmarshalText sets the address, it is used for environment variables
+func (l *ListenerConfig) UnmarshalText(text []byte) error {
+	*l = ListenerConfig{Address: string(text)}
+	return nil
+}
+
+// A Config holds the typed and validated configuration
+type Config struct {
+	Host                        HostList                `yaml:"host"`
+	PlayerLimit                 int                     `yaml:"player_limit"`
+	Servers                     map[string]ServerConfig `yaml:"servers"`
+	Groups                      map[string][]string     `yaml:"groups"`
+	GroupPrivs                  map[string]string       `yaml:"group_privs"`
+	Roles                       map[string][]string     `yaml:"roles"`
+	DefaultPrivs                []string                `yaml:"default_privs"`
+	GroupDefaultPrivs           map[string][]string     `yaml:"group_default_privs"`
+	DefaultServer               string                  `yaml:"default_server"`
+	ForceDefaultServer          bool                    `yaml:"force_default_server"`
+	Admin                       string                  `yaml:"admin"`
+	CSMRestrictionFlags         int                     `yaml:"csm_restriction_flags"`
+	CSMRestrictionNoderange     int                     `yaml:"csm_restriction_noderange"`
+	ServerReintegrationInterval int                     `yaml:"server_reintegration_interval"`
+	DisableBuiltin              bool                    `yaml:"disable_builtin"`
+	CommandPrefix               string                  `yaml:"command_prefix"`
+	ConsolePrompt               string                  `yaml:"console_prompt"`
+	DoFallback                  bool                    `yaml:"do_fallback"`
+	DisallowEmptyPasswords      bool                    `yaml:"disallow_empty_passwords"`
+	AllowNewPlayers             bool                    `yaml:"allow_new_players"`
+	Whitelist                   bool                    `yaml:"whitelist"`
+	BanFiles                    []string                `yaml:"ban_files"`
+	BanFileInterval             int                     `yaml:"ban_file_interval"`
+	Modchannels                 bool                    `yaml:"modchannels"`
+	ForceLatestProto            bool                    `yaml:"force_latest_proto"`
+	RemoteMediaServer           string                  `yaml:"remote_media_server"`
+	AuthBackend                 string                  `yaml:"auth_backend"`
+	AuthMaxFailures             int                     `yaml:"auth_max_failures"`
+	AuthMaxFailuresIP           int                     `yaml:"auth_max_failures_ip"`
+	AuthLockoutTime             int                     `yaml:"auth_lockout_time"`
+	AuthLockoutMaxTime          int                     `yaml:"auth_lockout_max_time"`
+	PSQLDB                      string                  `yaml:"psql_db"`
+	PSQLHost                    string                  `yaml:"psql_host"`
+	PSQLPort                    int                     `yaml:"psql_port"`
+	PSQLUser                    string                  `yaml:"psql_user"`
+	PSQLPassword                string                  `yaml:"psql_password"`
+	ServerlistURL               string                  `yaml:"serverlist_url"`
+	ServerlistAddress           string                  `yaml:"serverlist_address"`
+	ServerlistName              string                  `yaml:"serverlist_name"`
+	ServerlistDesc              string                  `yaml:"serverlist_desc"`
+	ServerlistDisplayURL        string                  `yaml:"serverlist_display_url"`
+	ServerlistCreative          bool                    `yaml:"serverlist_creative"`
+	ServerlistDamage            bool                    `yaml:"serverlist_damage"`
+	ServerlistPvP               bool                    `yaml:"serverlist_pvp"`
+	ServerlistGame              string                  `yaml:"serverlist_game"`
+	ServerlistCanSeeFarNames    bool                    `yaml:"serverlist_can_see_far_names"`
+	ServerlistMods              []string                `yaml:"serverlist_mods"`
+	ServerlistAnnounceInterval  int                     `yaml:"serverlist_announce_interval"`
+}
+
+// A ServerConfig holds the configuration of a single minetest server
+type ServerConfig struct {
+	Address string `yaml:"address"`
+	Priv    string `yaml:"priv"`
+}
+
+type configErrors []string
+
+func (e configErrors) Error() string {
+	return strings.Join(e, "\n")
+}
+
+func newConfig() *Config {
+	return &Config{
+		Host:                        HostList{{Address: "0.0.0.0:33000"}},
+		PlayerLimit:                 int(^uint(0) >> 1),
+		CSMRestrictionNoderange:     8,
+		ServerReintegrationInterval: 600,
+		CommandPrefix:               "#",
+		DoFallback:                  true,
+		AllowNewPlayers:             true,
+		BanFileInterval:             300,
+		Modchannels:                 true,
+		AuthBackend:                 "sql",
+		AuthMaxFailures:             5,
+		AuthMaxFailuresIP:           20,
+		AuthLockoutTime:             60,
+		AuthLockoutMaxTime:          3600,
+		PSQLHost:                    "localhost",
+		PSQLPort:                    5432,
+		ServerlistAnnounceInterval:  300,
+	}
+}
+
+// parseConfig decodes and validates a configuration file
+// Unknown keys are not fatal because plugins may define their own
+// and are returned separately
+func parseConfig(data []byte) (map[interface{}]interface{}, *Config, []string, error) {
+	raw := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, nil, err
+	}
+
+	c := newConfig()
+
+	var errs configErrors
+	if err := yaml.Unmarshal(data, c); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, nil, nil, err
+		}
+
+		errs = append(errs, typeErr.Errors...)
+	}
+
+	errs = append(errs, c.applyEnv(raw)...)
+
+	if c.ConsolePrompt == "" {
+		c.ConsolePrompt = c.CommandPrefix + ">"
+	}
+
+	warnings := unknownKeys("", raw, reflect.TypeOf(c))
+	sort.Strings(warnings)
+
+	errs = append(errs, c.validate()...)
+	if len(errs) > 0 {
+		return nil, nil, warnings, errs
+	}
+
+	return raw, c, warnings, nil
+}
+
+// applyEnv overrides top-level keys with the values of
+// environment variables named MULTISERVER_<KEY>, e.g. MULTISERVER_PSQL_PASSWORD
+func (c *Config) applyEnv(raw map[interface{}]interface{}) configErrors {
+	var errs configErrors
+
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+
+		value, ok := os.LookupEnv("MULTISERVER_" + strings.ToUpper(key))
+		if !ok {
+			continue
+		}
+
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(value)
+			raw[key] = value
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, "MULTISERVER_"+strings.ToUpper(key)+": "+err.Error())
+				continue
+			}
+
+			f.SetInt(int64(n))
+			raw[key] = n
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, "MULTISERVER_"+strings.ToUpper(key)+": "+err.Error())
+				continue
+			}
+
+			f.SetBool(b)
+			raw[key] = b
+		case reflect.Slice:
+			elemType := f.Type().Elem()
+			isText := reflect.PtrTo(elemType).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+
+			if elemType.Kind() != reflect.String && !isText {
+				errs = append(errs, "MULTISERVER_"+strings.ToUpper(key)+": "+key+" can't be set from the environment")
+				continue
+			}
+
+			// Lists are comma separated
+			var l []interface{}
+			s := reflect.MakeSlice(f.Type(), 0, 0)
+			for _, elem := range strings.Split(value, ",") {
+				elem = strings.TrimSpace(elem)
+				l = append(l, elem)
+
+				if !isText {
+					s = reflect.Append(s, reflect.ValueOf(elem).Convert(elemType))
+					continue
+				}
+
+				ev := reflect.New(elemType)
+				if err := ev.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(elem)); err != nil {
+					errs = append(errs, "MULTISERVER_"+strings.ToUpper(key)+": "+err.Error())
+				}
+
+				s = reflect.Append(s, ev.Elem())
+			}
+
+			f.Set(s)
+			raw[key] = l
+		default:
+			errs = append(errs, "MULTISERVER_"+strings.ToUpper(key)+": "+key+" can't be set from the environment")
+		}
+	}
+
+	return errs
+}
+
+func (c *Config) validate() configErrors {
+	var errs configErrors
+
+	if len(c.Servers) == 0 {
+		errs = append(errs, "servers: no servers configured")
+	}
+
+	for name, srv := range c.Servers {
+		if srv.Address == "" {
+			errs = append(errs, "servers."+name+".address: not set")
+			continue
+		}
+
+		if _, err := net.ResolveUDPAddr("udp", srv.Address); err != nil {
+			errs = append(errs, "servers."+name+".address: "+err.Error())
+		}
+	}
+
+	if c.DefaultServer == "" {
+		errs = append(errs, "default_server: not set")
+	} else if _, ok := c.Servers[c.DefaultServer]; !ok {
+		errs = append(errs, "default_server: unknown server "+c.DefaultServer)
+	}
+
+	for grp, members := range c.Groups {
+		if len(members) == 0 {
+			errs = append(errs, "groups."+grp+": group is empty")
+		}
+
+		for _, member := range members {
+			if _, ok := c.Servers[member]; !ok {
+				errs = append(errs, "groups."+grp+": unknown server "+member)
+			}
+		}
+	}
+
+	for grp := range c.GroupPrivs {
+		if _, ok := c.Groups[grp]; !ok {
+			errs = append(errs, "group_privs."+grp+": unknown group "+grp)
+		}
+	}
+
+	for _, priv := range c.DefaultPrivs {
+		if priv == "" || strings.ContainsAny(priv, "|, @") {
+			errs = append(errs, "default_privs: invalid privilege "+priv)
+		}
+	}
+
+	for grp, privs := range c.GroupDefaultPrivs {
+		if !c.IsGroup(grp) {
+			errs = append(errs, "group_default_privs."+grp+": unknown group "+grp)
+		}
+
+		for _, priv := range privs {
+			if priv == "" || strings.ContainsAny(priv, "|, @") {
+				errs = append(errs, "group_default_privs."+grp+": invalid privilege "+priv)
+			}
+		}
+	}
+
+	for role, privs := range c.Roles {
+		if role == "" || strings.ContainsAny(role, "|, ") {
+			errs = append(errs, "roles."+role+": invalid role name")
+		}
+
+		for _, priv := range privs {
+			if priv == "" || strings.ContainsAny(priv, "|, ") {
+				errs = append(errs, "roles."+role+": invalid privilege "+priv)
+			}
+
+			if i := strings.LastIndex(priv, "@"); i >= 0 {
+				scope := priv[i+1:]
+				if _, ok := c.Servers[scope]; !ok && !c.IsGroup(scope) {
+					errs = append(errs, "roles."+role+": unknown server or group "+scope)
+				}
+			}
+		}
+	}
+
+	if len(c.Host) == 0 {
+		errs = append(errs, "host: must not be empty")
+	}
+
+	hosts := make(map[string]bool)
+	for i, l := range c.Host {
+		host := l.Address
+		key := "host." + strconv.Itoa(i)
+
+		if host == "" {
+			errs = append(errs, key+".address: must not be empty")
+			continue
+		}
+
+		addr, err := net.ResolveUDPAddr(listenNetwork(host), host)
+		if err != nil {
+			errs = append(errs, "host: "+err.Error())
+			continue
+		}
+
+		if hosts[addr.String()] {
+			errs = append(errs, "host: duplicate address "+host)
+		}
+		hosts[addr.String()] = true
+
+		if l.PlayerLimit != nil && *l.PlayerLimit < 0 {
+			errs = append(errs, key+".player_limit: must not be negative")
+		}
+
+		if l.DefaultServer != nil {
+			if _, ok := c.Servers[*l.DefaultServer]; !ok {
+				errs = append(errs, key+".default_server: unknown server "+*l.DefaultServer)
+			}
+		}
+	}
+
+	if c.PlayerLimit < 0 {
+		errs = append(errs, "player_limit: must not be negative")
+	}
+
+	if c.ServerReintegrationInterval <= 0 {
+		errs = append(errs, "server_reintegration_interval: must be positive")
+	}
+
+	if c.ServerlistAnnounceInterval <= 0 {
+		errs = append(errs, "serverlist_announce_interval: must be positive")
+	}
+
+	if c.BanFileInterval <= 0 {
+		errs = append(errs, "ban_file_interval: must be positive")
+	}
+
+	if c.AuthBackend != "sql" && c.AuthBackend != "memory" {
+		errs = append(errs, "auth_backend: must be sql or memory")
+	}
+
+	if c.AuthMaxFailures < 0 {
+		errs = append(errs, "auth_max_failures: must not be negative")
+	}
+
+	if c.AuthMaxFailuresIP < 0 {
+		errs = append(errs, "auth_max_failures_ip: must not be negative")
+	}
+
+	if c.AuthLockoutTime <= 0 {
+		errs = append(errs, "auth_lockout_time: must be positive")
+	}
+
+	if c.AuthLockoutMaxTime < c.AuthLockoutTime {
+		errs = append(errs, "auth_lockout_max_time: must not be less than auth_lockout_time")
+	}
+
+	if c.PSQLDB != "" && c.PSQLUser == "" {
+		errs = append(errs, "psql_user: required if psql_db is set")
+	}
+
+	sort.Strings(errs)
+	return errs
+}
+
+// unknownKeys returns the keys of raw that have no corresponding
+// field in the type t
+func unknownKeys(prefix string, raw interface{}, t reflect.Type) []string {
+	var r []string
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return unknownKeys(prefix, raw, t.Elem())
+	case reflect.Struct:
+		m, ok := raw.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			fields[tag] = t.Field(i).Type
+		}
+
+		for k, v := range m {
+			key := fmt.Sprint(k)
+
+			ft, ok := fields[key]
+			if !ok {
+				r = append(r, prefix+key)
+				continue
+			}
 
-	err = yaml.Unmarshal(data, &config)
+			r = append(r, unknownKeys(prefix+key+".", v, ft)...)
+		}
+	case reflect.Map:
+		m, ok := raw.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+
+		for k, v := range m {
+			r = append(r, unknownKeys(prefix+fmt.Sprint(k)+".", v, t.Elem())...)
+		}
+	case reflect.Slice:
+		l, ok := raw.([]interface{})
+		if !ok {
+			return nil
+		}
+
+		for i, v := range l {
+			r = append(r, unknownKeys(prefix+strconv.Itoa(i)+".", v, t.Elem())...)
+		}
+	}
+
+	return r
+}
+
+// checkReachable reports the servers that don't respond
+func (c *Config) checkReachable() configErrors {
+	var errs configErrors
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, srv := range c.Servers {
+		wg.Add(1)
+		go func(name, addr string) {
+			defer wg.Done()
+
+			srvaddr, err := net.ResolveUDPAddr("udp", addr)
+			if err != nil {
+				return
+			}
+
+			conn, err := net.DialUDP("udp", nil, srvaddr)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, "servers."+name+".address: "+err.Error())
+				mu.Unlock()
+				return
+			}
+
+			srv, err := Connect(conn)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, "servers."+name+".address: "+err.Error())
+				mu.Unlock()
+				return
+			}
+			srv.Close()
+		}(name, srv.Address)
+	}
+
+	wg.Wait()
+
+	sort.Strings(errs)
+	return errs
+}
+
+func loadConfig() error {
+	raw, c, err := readConfig()
 	if err != nil {
 		return err
 	}
 
+	setConfig(raw, c)
 	return nil
 }
 
+// readConfig reads and parses the configuration file
+// without making it the current configuration
+func readConfig() (map[interface{}]interface{}, *Config, error) {
+	parseFlags()
+
+	os.MkdirAll(filepath.Dir(configPath), 0777)
+
+	_, err := os.Stat(configPath)
+	if os.IsNotExist(err) {
+		os.WriteFile(configPath, defaultConfig, 0666)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, c, warnings, err := parseConfig(data)
+	for _, key := range warnings {
+		log.Print("Unknown configuration key " + key)
+	}
+
+	return raw, c, err
+}
+
+// setConfig makes a configuration the current one
+func setConfig(raw map[interface{}]interface{}, c *Config) {
+	configMu.Lock()
+	config = raw
+	conf = c
+	configMu.Unlock()
+
+	ChatCommandPrefix = c.CommandPrefix
+}
+
+// resolveServerAddr returns the address a connection to a server uses
+// The address is returned as is if it can't be resolved
+func resolveServerAddr(addr string) string {
+	if addr == "" {
+		return ""
+	}
+
+	srvaddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return addr
+	}
+
+	return srvaddr.String()
+}
+
+// sameAddresses reports whether two host lists
+// contain the same listen addresses
+func (h HostList) sameAddresses(h2 HostList) bool {
+	addrs := make(map[string]int)
+	for _, l := range h {
+		addrs[l.Address]++
+	}
+
+	for _, l := range h2 {
+		addrs[l.Address]--
+	}
+
+	for _, n := range addrs {
+		if n != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// initConfig loads the configuration for the first time
+// This happens before any other subsystem is started,
+// the process exits if the configuration is invalid
+// or if the -check-config flag is set
+func initConfig() {
+	parseFlags()
+
+	err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if checkConfig {
+		if errs := conf.checkReachable(); len(errs) > 0 {
+			fmt.Fprintln(os.Stderr, "Invalid configuration:")
+			fmt.Fprintln(os.Stderr, errs)
+			os.Exit(1)
+		}
+
+		fmt.Println("Configuration OK")
+		os.Exit(0)
+	}
+}
+
+var configOnce sync.Once
+
+// Conf returns the current configuration
+// The returned Config must not be modified
+func Conf() *Config {
+	configOnce.Do(initConfig)
+
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	return conf
+}
+
 // ConfKey returns a key from the configuration
 func ConfKey(key string) interface{} {
-	if config == nil {
-		loadConfig()
-	}
+	configOnce.Do(initConfig)
 
-	keys := strings.Split(key, ":")
+	configMu.RLock()
 	c := config
+	configMu.RUnlock()
+
+	keys := strings.Split(key, ":")
 	for i := 0; i < len(keys)-1; i++ {
 		if c[keys[i]] == nil {
 			return nil
@@ -56,3 +674,149 @@ func ConfKey(key string) interface{} {
 
 	return c[keys[len(keys)-1]]
 }
+
+// ForListener returns a copy of the configuration
+// with the settings of the listener on host applied
+// The configuration itself is returned if there is no such listener
+func (c *Config) ForListener(host string) *Config {
+	for _, l := range c.Host {
+		if l.Address != host {
+			continue
+		}
+
+		lc := *c
+
+		v := reflect.ValueOf(&lc).Elem()
+		lv := reflect.ValueOf(l)
+		for i := 0; i < lv.NumField(); i++ {
+			f := lv.Field(i)
+			if f.Kind() != reflect.Ptr || f.IsNil() {
+				continue
+			}
+
+			v.FieldByName(lv.Type().Field(i).Name).Set(f.Elem())
+		}
+
+		return &lc
+	}
+
+	return c
+}
+
+// ReachesServer reports whether the players of a listener configuration
+// returned by ForListener may be sent back to their last server
+// This is the case if it is the default server or in a group with it,
+// with a single listener every server is reachable
+func (c *Config) ReachesServer(server string) bool {
+	if len(c.Host) <= 1 || server == c.DefaultServer {
+		return true
+	}
+
+	for _, members := range c.Groups {
+		var hasDefault, hasServer bool
+		for _, member := range members {
+			hasDefault = hasDefault || member == c.DefaultServer
+			hasServer = hasServer || member == server
+		}
+
+		if hasDefault && hasServer {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ServerByAddr returns the name of the server running on addr
+func (c *Config) ServerByAddr(addr string) string {
+	for name, srv := range c.Servers {
+		if srv.Address == addr {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// IsGroup reports whether a server group exists
+func (c *Config) IsGroup(name string) bool {
+	_, ok := c.Groups[name]
+	return ok
+}
+
+// reloadMu serializes reloads so that concurrent ones
+// don't compare against the same old configuration
+var reloadMu sync.Mutex
+
+// ReloadConfig re-reads the configuration file and applies the changes
+// RPC connections and media are set up for new servers
+// and players are moved off removed servers
+func ReloadConfig() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	old := Conf()
+
+	raw, c, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	// Listeners are only started once and connections find
+	// the settings of their listener by its address
+	if !c.Host.sameAddresses(old.Host) {
+		return errors.New("host: changing the listen addresses requires a restart")
+	}
+
+	setConfig(raw, c)
+
+	// Connections use resolved addresses, e.g. 127.0.0.1:30001 for localhost:30001
+	removed := make(map[string]string)
+	for name, srv := range old.Servers {
+		if addr := resolveServerAddr(srv.Address); resolveServerAddr(c.Servers[name].Address) != addr {
+			removed[addr] = name
+		}
+	}
+
+	added := false
+	for name, srv := range c.Servers {
+		if resolveServerAddr(old.Servers[name].Address) != resolveServerAddr(srv.Address) {
+			added = true
+		}
+	}
+
+	rpcSrvMu.Lock()
+	for srv := range rpcSrvs {
+		if _, ok := removed[srv.Addr().String()]; ok && srv.NoClt() {
+			srv.Close()
+			delete(rpcSrvs, srv)
+		}
+	}
+	rpcSrvMu.Unlock()
+
+	for _, clt := range Conns() {
+		if clt.Server() == nil {
+			continue
+		}
+
+		if name, ok := removed[clt.Server().Addr().String()]; ok {
+			log.Print("Server " + name + " has been removed, moving " + clt.Username() + " to the default server")
+
+			clt.SendChatMsg("The minetest server has been removed, connecting you to the default server...")
+			go clt.Redirect(c.ForListener(clt.host).DefaultServer)
+		}
+	}
+
+	if added {
+		go reconnectRpc(true)
+	}
+
+	if err := ReloadRangeBans(); err != nil {
+		log.Print(err)
+	}
+	resetBanFileInterval()
+
+	log.Print("Reloaded configuration")
+
+	return nil
+}
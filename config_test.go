@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestReachesServer(t *testing.T) {
+	c := &Config{
+		Host:          HostList{{Address: "0.0.0.0:33000"}, {Address: "0.0.0.0:33001"}},
+		DefaultServer: "survival",
+		Groups: map[string][]string{
+			"public":  {"survival", "minigames"},
+			"private": {"creative"},
+		},
+	}
+
+	for server, want := range map[string]bool{
+		"survival":  true,
+		"minigames": true,
+		"creative":  false,
+		"":          false,
+	} {
+		if got := c.ReachesServer(server); got != want {
+			t.Errorf("ReachesServer(%q) = %v, want %v", server, got, want)
+		}
+	}
+
+	c.Host = c.Host[:1]
+	if !c.ReachesServer("creative") {
+		t.Error("ReachesServer(creative) = false with a single listener")
+	}
+}
@@ -12,8 +12,37 @@ import (
 )
 
 var connectedConns int = 0
+var listenerConns = make(map[string]int)
 var connectedConnsMu sync.RWMutex
 
+// addConnectedConn counts a client Conn as connected
+// unless the global or the listener player limit has been reached
+func addConnectedConn(c *Conn) bool {
+	limit := Conf().PlayerLimit
+	listenerLimit := c.ListenerConf().PlayerLimit
+
+	connectedConnsMu.Lock()
+	defer connectedConnsMu.Unlock()
+
+	if connectedConns >= limit || listenerConns[c.host] >= listenerLimit {
+		return false
+	}
+
+	connectedConns++
+	listenerConns[c.host]++
+
+	return true
+}
+
+// removeConnectedConn stops counting a client Conn that has disconnected
+func removeConnectedConn(c *Conn) {
+	connectedConnsMu.Lock()
+	defer connectedConnsMu.Unlock()
+
+	connectedConns--
+	listenerConns[c.host]--
+}
+
 // A Conn is a connection to a client or server
 type Conn struct {
 	*rudp.Conn
@@ -29,6 +58,13 @@ type Conn struct {
 	authMech int
 	sudoMode bool
 
+	joinTime time.Time
+
+	host string
+
+	rotationMu sync.Mutex
+	rotation   *passwordRotation
+
 	stopforward bool
 	forwardMu   sync.RWMutex
 
@@ -63,6 +99,12 @@ func (c *Conn) Addr() net.Addr {
 	return c.Conn.RemoteAddr()
 }
 
+// ListenerConf returns the configuration with the settings
+// of the listener the Conn has connected to applied
+func (c *Conn) ListenerConf() *Config {
+	return Conf().ForListener(c.host)
+}
+
 // Username returns the username of the Conn
 // if it isn't a server
 func (c *Conn) Username() string { return c.username }
@@ -92,17 +134,22 @@ func (c *Conn) Server() *Conn {
 	return c.srv
 }
 
+// IP returns the IP address of a Conn
+// Clients that connect to a dual-stack socket over IPv4
+// have IPv4-mapped IPv6 addresses, these are returned as IPv4 addresses
+func (c *Conn) IP() net.IP {
+	ip := c.Addr().(*net.UDPAddr).IP
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+
+	return ip
+}
+
 // ServerName returns the name of the Conn this Conn is connected to
 // if this Conn is not a server
 func (c *Conn) ServerName() string {
-	servers := ConfKey("servers").(map[interface{}]interface{})
-	for server := range servers {
-		if ConfKey("servers:"+server.(string)+":address") == c.Server().Addr().String() {
-			return server.(string)
-		}
-	}
-
-	return ""
+	return Conf().ServerByAddr(c.Server().Addr().String())
 }
 
 // SetServer sets the Conn this Conn is connected to
@@ -12,15 +12,7 @@ import (
 var consoleInput []rune
 
 func draw(msgs []string) {
-	prompt, ok := ConfKey("console_prompt").(string)
-	if !ok {
-		prefix, ok := ConfKey("command_prefix").(string)
-		if !ok {
-			prefix = "#"
-		}
-
-		prompt = prefix + ">"
-	}
+	prompt := Conf().ConsolePrompt
 
 	gocurses.Clear()
 
@@ -2,12 +2,14 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
+	"sync"
 
-	_ "github.com/lib/pq"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 )
 
 const (
@@ -15,26 +17,53 @@ const (
 	DBTypePSQL
 )
 
+var placeholderRegexp = regexp.MustCompile(`\$[0-9]+`)
+
+var openDBs []*DB
+var openDBsMu sync.Mutex
+
 type DB struct {
 	*sql.DB
 	dbType int
+
+	stmtMu sync.Mutex
+	stmts  map[string]*sql.Stmt
+}
+
+func newDB(db *sql.DB, dbType int) *DB {
+	r := &DB{
+		DB:     db,
+		dbType: dbType,
+		stmts:  make(map[string]*sql.Stmt),
+	}
+
+	openDBsMu.Lock()
+	openDBs = append(openDBs, r)
+	openDBsMu.Unlock()
+
+	return r
 }
 
 // OpenSQLite3 opens and returns a SQLite3 database
 func OpenSQLite3(name, initSQL string) (*DB, error) {
-	os.Mkdir("storage", 0777)
+	os.MkdirAll(DataPath(""), 0777)
 
-	db, err := sql.Open("sqlite3", "storage/"+name)
+	db, err := sql.Open("sqlite3", DataPath(name))
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := db.Exec(initSQL); err != nil {
-		db.Close()
-		return nil, err
+	// SQLite3 only supports one writer at a time
+	db.SetMaxOpenConns(1)
+
+	if initSQL != "" {
+		if _, err := db.Exec(initSQL); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 
-	return &DB{DB: db, dbType: DBTypeSQLite3}, nil
+	return newDB(db, DBTypeSQLite3), nil
 }
 
 // OpenPSQL opens and returns a PostgreSQL database
@@ -52,39 +81,136 @@ func OpenPSQL(name, user, password, initSQL, host string, port int) (*DB, error)
 		return nil, err
 	}
 
-	if _, err := db.Exec(initSQL); err != nil {
-		db.Close()
-		return nil, err
+	if initSQL != "" {
+		if _, err := db.Exec(initSQL); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 
-	return &DB{DB: db, dbType: DBTypePSQL}, nil
+	return newDB(db, DBTypePSQL), nil
+}
+
+// OpenConfDB opens the configured PostgreSQL database if psql_db is set
+// and the SQLite3 database called name otherwise
+func OpenConfDB(name string) (*DB, error) {
+	c := Conf()
+	if c.PSQLDB == "" {
+		return OpenSQLite3(name, "")
+	}
+
+	return OpenPSQL(c.PSQLDB, c.PSQLUser, c.PSQLPassword, "", c.PSQLHost, c.PSQLPort)
+}
+
+// isUniqueViolation reports whether err is caused
+// by a unique or primary key constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	var psqlErr *pq.Error
+	if errors.As(err, &psqlErr) {
+		return psqlErr.Code == "23505"
+	}
+
+	return false
 }
 
 // Type returns the type of database that is being interacted with
 func (db *DB) Type() int { return db.dbType }
 
+// rebind converts the $n placeholders of a query
+// to the syntax of the database
+func (db *DB) rebind(query string) string {
+	if db.Type() == DBTypeSQLite3 {
+		return placeholderRegexp.ReplaceAllString(query, "?")
+	}
+
+	return query
+}
+
+// Prepare returns a prepared statement for a query
+// Statements are cached and must not be closed by the caller
+func (db *DB) Prepare(query string) (*sql.Stmt, error) {
+	db.stmtMu.Lock()
+	defer db.stmtMu.Unlock()
+
+	if stmt, ok := db.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := db.DB.Prepare(db.rebind(query))
+	if err != nil {
+		return nil, err
+	}
+
+	db.stmts[query] = stmt
+	return stmt, nil
+}
+
 // Exec executes a SQL statement
 func (db *DB) Exec(sql string, values ...interface{}) (sql.Result, error) {
-	if db.Type() == DBTypeSQLite3 {
-		r, err := regexp.Compile("\\$+[0-9]")
-		if err != nil {
-			return nil, err
-		}
+	stmt, err := db.Prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.Exec(values...)
+}
 
-		sql = r.ReplaceAllString(sql, "?")
+// Query executes a SQL statement and returns the resulting rows
+func (db *DB) Query(sql string, values ...interface{}) (*sql.Rows, error) {
+	stmt, err := db.Prepare(sql)
+	if err != nil {
+		return nil, err
 	}
-	return db.DB.Exec(sql, values...)
+
+	return stmt.Query(values...)
 }
 
 // QueryRow executes a SQL statement and stores the results
 func (db *DB) QueryRow(sql string, values ...interface{}) *sql.Row {
-	if db.Type() == DBTypeSQLite3 {
-		r, err := regexp.Compile("\\$+[0-9]")
-		if err != nil {
-			return nil
+	stmt, err := db.Prepare(sql)
+	if err != nil {
+		// Let the error surface when the row is scanned,
+		// the query is rebound so it is the same error
+		return db.DB.QueryRow(db.rebind(sql), values...)
+	}
+
+	return stmt.QueryRow(values...)
+}
+
+// Close closes the prepared statements and the database
+func (db *DB) Close() error {
+	db.stmtMu.Lock()
+	for query, stmt := range db.stmts {
+		stmt.Close()
+		delete(db.stmts, query)
+	}
+	db.stmtMu.Unlock()
+
+	openDBsMu.Lock()
+	for i, odb := range openDBs {
+		if odb == db {
+			openDBs = append(openDBs[:i], openDBs[i+1:]...)
+			break
 		}
+	}
+	openDBsMu.Unlock()
 
-		sql = r.ReplaceAllString(sql, "?")
+	return db.DB.Close()
+}
+
+func closeDBs() {
+	openDBsMu.Lock()
+	dbs := make([]*DB, len(openDBs))
+	copy(dbs, openDBs)
+	openDBsMu.Unlock()
+
+	for _, db := range dbs {
+		db.Close()
 	}
-	return db.DB.QueryRow(sql, values...)
 }
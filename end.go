@@ -31,6 +31,8 @@ func End(crash, reconnect bool) {
 
 	Announce(AnnounceDelete)
 
+	closeDBs()
+
 	log.Writer().(*Logger).Close()
 
 	gocurses.End()
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// exportVersion is the version of the export format
+// It must be incremented when the format changes
+const exportVersion = 7
+
+// An Export is a JSON document containing the accounts,
+// privileges, bans and storage entries of the proxy
+type Export struct {
+	Version    int                 `json:"version"`
+	Auth       []ExportAccount     `json:"auth"`
+	Privileges map[string][]string `json:"privileges"`
+	Ban        []ExportBan         `json:"ban"`
+	Storage    map[string]string   `json:"storage"`
+	// Whitelist was added in version 3
+	Whitelist []string `json:"whitelist,omitempty"`
+	// NameBan was added in version 5, Addr is empty
+	NameBan []ExportBan `json:"name_ban,omitempty"`
+	// Mute was added in version 6
+	Mute []ExportMute `json:"mute,omitempty"`
+	// Roles was added in version 7
+	Roles map[string][]string `json:"roles,omitempty"`
+}
+
+// An ExportAccount is an entry of the auth table
+// Password is the encoded SRP salt and verifier,
+// times are unix timestamps and playtime is in seconds
+// The activity fields were added in version 2
+type ExportAccount struct {
+	Name       string `json:"name"`
+	Password   string `json:"password"`
+	FirstLogin int64  `json:"first_login,omitempty"`
+	LastLogin  int64  `json:"last_login,omitempty"`
+	LastAddr   string `json:"last_addr,omitempty"`
+	Playtime   int64  `json:"playtime,omitempty"`
+}
+
+func unixOrNone(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+func timeOrNone(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
+
+// An ExportBan is an entry of the ban table
+// Times are unix timestamps, an expiry of 0 means that the ban
+// is permanent
+// Reason, issuer and times were added in version 4
+type ExportBan struct {
+	Addr    string `json:"addr"`
+	Name    string `json:"name"`
+	Reason  string `json:"reason,omitempty"`
+	Issuer  string `json:"issuer,omitempty"`
+	Created int64  `json:"created,omitempty"`
+	Expires int64  `json:"expires,omitempty"`
+}
+
+// An ExportMute is an entry of the mute table
+// Times are unix timestamps, an expiry of 0 means that the mute
+// is permanent
+type ExportMute struct {
+	Name    string `json:"name"`
+	Reason  string `json:"reason,omitempty"`
+	Issuer  string `json:"issuer,omitempty"`
+	Created int64  `json:"created,omitempty"`
+	Expires int64  `json:"expires,omitempty"`
+}
+
+func exportBan(b BanEntry) ExportBan {
+	return ExportBan{
+		Addr:    b.Addr,
+		Name:    b.Name,
+		Reason:  b.Reason,
+		Issuer:  b.Issuer,
+		Created: unixOrNone(b.Created),
+		Expires: unixOrNone(b.Expires),
+	}
+}
+
+func (b ExportBan) entry() *BanEntry {
+	return &BanEntry{
+		Addr:    b.Addr,
+		Name:    b.Name,
+		Reason:  b.Reason,
+		Issuer:  b.Issuer,
+		Created: timeOrNone(b.Created),
+		Expires: timeOrNone(b.Expires),
+	}
+}
+
+// ExportState returns the current state of the auth backend
+// and the storage database
+func ExportState() (*Export, error) {
+	e := &Export{
+		Version:    exportVersion,
+		Auth:       []ExportAccount{},
+		Privileges: make(map[string][]string),
+		Ban:        []ExportBan{},
+	}
+
+	users, err := Auth().UserList()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range users {
+		verifier, salt, err := Auth().Password(name)
+		if err != nil {
+			return nil, err
+		}
+
+		acc := ExportAccount{
+			Name:     name,
+			Password: encodeVerifierAndSalt(salt, verifier),
+		}
+
+		a, err := Auth().Activity(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if a != nil {
+			acc.FirstLogin = unixOrNone(a.FirstLogin)
+			acc.LastLogin = unixOrNone(a.LastLogin)
+			acc.LastAddr = a.LastAddr
+			acc.Playtime = int64(a.Playtime / time.Second)
+		}
+
+		e.Auth = append(e.Auth, acc)
+	}
+
+	privs, err := Auth().PrivsList()
+	if err != nil {
+		return nil, err
+	}
+
+	for name, p := range privs {
+		var ps []string
+		for priv := range p {
+			ps = append(ps, priv)
+		}
+		sort.Strings(ps)
+
+		e.Privileges[name] = ps
+	}
+
+	roles, err := Auth().RolesList()
+	if err != nil {
+		return nil, err
+	}
+
+	for name, r := range roles {
+		var rs []string
+		for role := range r {
+			rs = append(rs, role)
+		}
+		sort.Strings(rs)
+
+		if e.Roles == nil {
+			e.Roles = make(map[string][]string)
+		}
+
+		e.Roles[name] = rs
+	}
+
+	bans, err := Auth().Bans()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range bans {
+		e.Ban = append(e.Ban, exportBan(b))
+	}
+
+	nameBans, err := Auth().NameBans()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range nameBans {
+		e.NameBan = append(e.NameBan, exportBan(b))
+	}
+
+	mutes, err := Auth().Mutes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range mutes {
+		e.Mute = append(e.Mute, ExportMute{
+			Name:    m.Name,
+			Reason:  m.Reason,
+			Issuer:  m.Issuer,
+			Created: unixOrNone(m.Created),
+			Expires: unixOrNone(m.Expires),
+		})
+	}
+
+	e.Storage, err = StorageEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	e.Whitelist, err = Auth().Whitelist()
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// ErrPassphraseChange is returned when an Export would replace
+// the passphrase of a running proxy
+var ErrPassphraseChange = errors.New("the export contains a different passphrase for the minetest servers, " +
+	"logins to servers that use the current one would fail")
+
+// validate checks an Export before anything is imported
+// A different passphrase is only accepted if replacePassphrase is true
+// or no passphrase has been loaded
+func (e *Export) validate(replacePassphrase bool) error {
+	if e.Version < 1 || e.Version > exportVersion {
+		return fmt.Errorf("unsupported export version %d", e.Version)
+	}
+
+	for _, acc := range e.Auth {
+		if acc.Name == "" {
+			return errors.New("account without name")
+		}
+
+		if _, _, err := decodeVerifierAndSalt(acc.Password); err != nil {
+			return fmt.Errorf("password of %s: %w", acc.Name, err)
+		}
+	}
+
+	for _, ban := range e.Ban {
+		if _, _, err := parseBanAddr(ban.Addr); err != nil {
+			return fmt.Errorf("ban of %s: %w", ban.Addr, err)
+		}
+	}
+
+	for _, ban := range e.NameBan {
+		if ban.Name == "" {
+			return errors.New("name ban without name")
+		}
+	}
+
+	for _, m := range e.Mute {
+		if m.Name == "" {
+			return errors.New("mute without name")
+		}
+	}
+
+	if pwd, ok := e.Storage["auth:passphrase"]; ok {
+		p, err := decodePassphrase(pwd)
+		if err != nil {
+			return fmt.Errorf("auth:passphrase: %w", err)
+		}
+
+		if cur := passphrase(); cur != nil && !bytes.Equal(p, cur) && !replacePassphrase {
+			return ErrPassphraseChange
+		}
+	}
+
+	return nil
+}
+
+// ImportState restores an Export
+// Existing entries with the same name, address or key are replaced,
+// other entries are left unchanged
+// The passphrase of a running proxy is only replaced
+// if replacePassphrase is true
+func ImportState(e *Export, replacePassphrase bool) error {
+	if err := e.validate(replacePassphrase); err != nil {
+		return err
+	}
+
+	for _, acc := range e.Auth {
+		salt, verifier, _ := decodeVerifierAndSalt(acc.Password)
+
+		v, _, err := Auth().Password(acc.Name)
+		if err != nil {
+			return err
+		}
+
+		if v != nil {
+			err = Auth().SetPassword(acc.Name, verifier, salt)
+		} else {
+			err = Auth().CreateUser(acc.Name, verifier, salt, nil)
+		}
+
+		if err != nil {
+			return fmt.Errorf("account %s: %w", acc.Name, err)
+		}
+
+		if e.Version < 2 {
+			continue
+		}
+
+		err = Auth().SetActivity(acc.Name, &Activity{
+			FirstLogin: timeOrNone(acc.FirstLogin),
+			LastLogin:  timeOrNone(acc.LastLogin),
+			LastAddr:   acc.LastAddr,
+			Playtime:   time.Duration(acc.Playtime) * time.Second,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, ps := range e.Privileges {
+		if err := Auth().SetPrivs(name, privs(ps...)); err != nil {
+			return err
+		}
+	}
+
+	for name, rs := range e.Roles {
+		if err := Auth().SetRoles(name, privs(rs...)); err != nil {
+			return err
+		}
+	}
+
+	for _, ban := range e.Ban {
+		b := ban.entry()
+		b.Addr, _, _ = parseBanAddr(b.Addr)
+
+		if err := Auth().Ban(b); err != nil {
+			return err
+		}
+	}
+
+	for _, ban := range e.NameBan {
+		if err := Auth().BanName(ban.entry()); err != nil {
+			return err
+		}
+	}
+
+	if err := ReloadRangeBans(); err != nil {
+		return err
+	}
+
+	for _, m := range e.Mute {
+		err := Auth().Mute(&Mute{
+			Name:    m.Name,
+			Reason:  m.Reason,
+			Issuer:  m.Issuer,
+			Created: timeOrNone(m.Created),
+			Expires: timeOrNone(m.Expires),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range e.Whitelist {
+		if err := Auth().WhitelistAdd(name); err != nil {
+			return err
+		}
+	}
+
+	for key, value := range e.Storage {
+		if err := SetStorageKey(key, value); err != nil {
+			return err
+		}
+	}
+
+	if pwd, ok := e.Storage["auth:passphrase"]; ok {
+		p, _ := decodePassphrase(pwd)
+
+		if cur := passphrase(); cur != nil && !bytes.Equal(p, cur) {
+			log.Print("Replaced the passphrase for the minetest servers, " +
+				"logins to servers whose auth databases use the old one will fail")
+		}
+
+		setPassphrase(p)
+	}
+
+	return nil
+}
+
+// ExportJSON writes an Export of the current state to w
+func ExportJSON(w io.Writer) error {
+	e, err := ExportState()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(e)
+}
+
+// ImportJSON reads an Export from r and restores it
+func ImportJSON(r io.Reader, replacePassphrase bool) error {
+	e := &Export{}
+	if err := json.NewDecoder(r).Decode(e); err != nil {
+		return err
+	}
+
+	return ImportState(e, replacePassphrase)
+}
+
+// ExportFile writes an Export to a file, - is stdout
+func ExportFile(path string) error {
+	if path == "-" {
+		return ExportJSON(os.Stdout)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := ExportJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// ImportFile restores an Export from a file, - is stdin
+func ImportFile(path string, replacePassphrase bool) error {
+	if path == "-" {
+		return ImportJSON(os.Stdin, replacePassphrase)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return ImportJSON(f, replacePassphrase)
+}
+
+func init() {
+	subcommands["export"] = subcommand{
+		usage: "<file|->",
+		help:  "Export accounts, privileges, bans and storage entries to a JSON file",
+		fn: func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: export <file|->")
+			}
+
+			if err := ExportFile(args[0]); err != nil {
+				return err
+			}
+
+			Audit(actorName(nil), "export", "", args[0])
+			return nil
+		},
+	}
+
+	subcommands["import"] = subcommand{
+		usage: "<file|->",
+		help:  "Import accounts, privileges, bans and storage entries from a JSON file",
+		fn: func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: import <file|->")
+			}
+
+			if err := ImportFile(args[0], false); err != nil {
+				return err
+			}
+
+			Audit(actorName(nil), "import", "", args[0])
+			return nil
+		},
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestImportPassphrase(t *testing.T) {
+	testMemBackends(t)
+
+	cur := []byte("current passphrase")
+	setPassphrase(cur)
+	defer setPassphrase(nil)
+
+	e := &Export{
+		Version: exportVersion,
+		Storage: map[string]string{"auth:passphrase": encodePassphrase([]byte("other passphrase"))},
+	}
+
+	if err := ImportState(e, false); !errors.Is(err, ErrPassphraseChange) {
+		t.Fatalf("ImportState without replacePassphrase = %v", err)
+	}
+
+	if !bytes.Equal(passphrase(), cur) {
+		t.Fatal("passphrase replaced without replacePassphrase")
+	}
+
+	if v, _ := StorageKey("auth:passphrase"); v != "" {
+		t.Fatal("storage changed by a refused import")
+	}
+
+	if err := ImportState(e, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(passphrase(), []byte("other passphrase")) {
+		t.Fatal("passphrase not replaced with replacePassphrase")
+	}
+}
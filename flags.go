@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+var checkConfig bool
+
+var configPath string
+var dataDir string
+var cacheDir string
+var logDir string
+
+var flagsOnce sync.Once
+
+func envOr(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+
+	return def
+}
+
+// parseFlags reads the command line flags
+// Flags take precedence over environment variables
+func parseFlags() {
+	flagsOnce.Do(func() {
+		flag.BoolVar(&checkConfig, "check-config", false, "Validate the configuration file and exit")
+		flag.StringVar(&configPath, "config", envOr("MULTISERVER_CONFIG", "config/multiserver.yml"), "Path of the configuration file (env MULTISERVER_CONFIG)")
+		flag.StringVar(&dataDir, "data-dir", envOr("MULTISERVER_DATA_DIR", "storage"), "Directory of the SQLite3 databases (env MULTISERVER_DATA_DIR)")
+		flag.StringVar(&cacheDir, "cache-dir", envOr("MULTISERVER_CACHE_DIR", "cache"), "Directory of the media cache (env MULTISERVER_CACHE_DIR)")
+		flag.StringVar(&logDir, "log-dir", envOr("MULTISERVER_LOG_DIR", "log"), "Directory of the log files (env MULTISERVER_LOG_DIR)")
+
+		flag.Usage = func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [subcommand [args]]\n", os.Args[0])
+			flag.PrintDefaults()
+			printSubcommands()
+		}
+
+		flag.Parse()
+	})
+}
+
+// DataPath returns the path of a file in the data directory
+func DataPath(name string) string {
+	parseFlags()
+	return filepath.Join(dataDir, name)
+}
+
+// CachePath returns the path of a file in the cache directory
+func CachePath(name string) string {
+	parseFlags()
+	return filepath.Join(cacheDir, name)
+}
+
+// LogPath returns the path of a file in the log directory
+func LogPath(name string) string {
+	parseFlags()
+	return filepath.Join(logDir, name)
+}
+
+type subcommand struct {
+	usage string
+	help  string
+	fn    func(args []string) error
+}
+
+// subcommands can be run instead of the proxy,
+// they are registered by init functions
+var subcommands = make(map[string]subcommand)
+
+func printSubcommands() {
+	var names []string
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(flag.CommandLine.Output(), "Subcommands:")
+	for _, name := range names {
+		cmd := subcommands[name]
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s %s\n    \t%s\n", name, cmd.usage, cmd.help)
+	}
+}
+
+// runSubcommand runs the subcommand named by args[0]
+// and exits with a non-zero status if it fails
+func runSubcommand(args []string) {
+	cmd, ok := subcommands[args[0]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Unknown subcommand", args[0])
+		printSubcommands()
+		os.Exit(2)
+	}
+
+	err := cmd.fn(args[1:])
+	closeDBs()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
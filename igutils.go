@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func privs(args ...string) map[string]bool {
@@ -21,9 +25,74 @@ func SendChatMsg(c *Conn, msg string) {
 	}
 }
 
-func init() {
-	disable, ok := ConfKey("disable_builtin").(bool)
-	if ok && disable {
+// allowedOn reports if the player running a command has the specified
+// privileges on the server or group it acts on and tells it if not
+// Only global privileges count if server is empty,
+// the console has all privileges
+func allowedOn(c *Conn, server string, req map[string]bool) bool {
+	if c == nil {
+		return true
+	}
+
+	allow, err := CheckPrivsOn(c.Username(), server, req)
+	if err != nil {
+		log.Print(err)
+		c.SendChatMsg("An internal error occured while attempting to check your privileges.")
+		return false
+	}
+
+	if !allow {
+		where := " globally"
+		if server != "" {
+			where = " on " + server
+		}
+
+		c.SendChatMsg("You do not have permission to do this" + where + "! Required privileges: " + strings.Replace(encodePrivs(req), "|", " ", -1))
+	}
+
+	return allow
+}
+
+// allowedToChangePrivs reports if the player running grant or revoke may
+// change the specified privileges and tells it if not
+// Players that only have privs scoped to a server or group
+// may only change privileges scoped to it
+func allowedToChangePrivs(c *Conn, privnames []string) bool {
+	if c == nil {
+		return true
+	}
+
+	global, err := CheckPrivs(c.Username(), privs("privs"))
+	if err != nil {
+		log.Print(err)
+		c.SendChatMsg("An internal error occured while attempting to check your privileges.")
+		return false
+	}
+
+	if global {
+		return true
+	}
+
+	for _, priv := range privnames {
+		_, scope := splitPriv(priv)
+		if scope == "" {
+			c.SendChatMsg("You can only change privileges scoped to a server or group you have the privs privilege on! Not scoped: " + priv)
+			return false
+		}
+
+		if !allowedOn(c, scope, privs("privs")) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// initChatCommands registers the builtin chat commands
+// It must not be called from an init function
+// because it loads the configuration
+func initChatCommands() {
+	if Conf().DisableBuiltin {
 		return
 	}
 
@@ -37,7 +106,7 @@ func init() {
 				if help := cmd.Help(); help != "" {
 					if c != nil {
 						color := "#F00"
-						if has, err := c.CheckPrivs(cmd.privs); (err == nil && has) || cmd.privs == nil {
+						if has, err := c.checkCommandPrivs(name); (err == nil && has) || cmd.privs == nil {
 							color = "#0F0"
 						}
 
@@ -83,8 +152,7 @@ func init() {
 				return
 			}
 
-			servers := ConfKey("servers").(map[interface{}]interface{})
-			if servers[tosrv] == nil {
+			if _, ok := Conf().Servers[tosrv]; !ok {
 				SendChatMsg(c, "Unknown servername "+tosrv)
 				return
 			}
@@ -101,6 +169,12 @@ func init() {
 				return
 			}
 
+			if !allowedOn(c, srv, privs("send")) || !allowedOn(c, tosrv, privs("send")) {
+				return
+			}
+
+			Audit(actorName(c), "send", name, tosrv)
+
 			go c2.Redirect(tosrv)
 		})
 
@@ -114,8 +188,7 @@ func init() {
 				return
 			}
 
-			servers := ConfKey("servers").(map[interface{}]interface{})
-			if servers[param] == nil {
+			if _, ok := Conf().Servers[param]; !ok {
 				c.SendChatMsg("Unknown servername " + param)
 				return
 			}
@@ -126,6 +199,12 @@ func init() {
 				return
 			}
 
+			if !allowedOn(c, param, privs("send")) {
+				return
+			}
+
+			Audit(actorName(c), "sendcurrent", srv, param)
+
 			go func() {
 				for _, c := range Conns() {
 					if c.ServerName() == srv {
@@ -145,12 +224,13 @@ func init() {
 				return
 			}
 
-			servers := ConfKey("servers").(map[interface{}]interface{})
-			if servers[param] == nil {
+			if _, ok := Conf().Servers[param]; !ok {
 				SendChatMsg(c, "Unknown servername "+param)
 				return
 			}
 
+			Audit(actorName(c), "sendall", "", param)
+
 			go func() {
 				for _, c := range Conns() {
 					if psrv := c.ServerName(); psrv != param {
@@ -176,22 +256,18 @@ func init() {
 		func(c *Conn, param string) {
 			if param == "" {
 				var r string
-				servers := ConfKey("servers").(map[interface{}]interface{})
-				for server := range servers {
-					r += server.(string) + " "
+				for server := range Conf().Servers {
+					r += server + " "
 				}
 
 				var r2 string
-				groups, ok := ConfKey("groups").(map[interface{}]interface{})
-				if ok {
-					for group := range groups {
-						r2 += group.(string) + " "
-					}
+				for group := range Conf().Groups {
+					r2 += group + " "
 				}
 
 				c.SendChatMsg("Current server: " + c.ServerName() + " | All servers: " + r + "| All server groups: " + r2)
 			} else {
-				servers := ConfKey("servers").(map[interface{}]interface{})
+				conf := Conf()
 				srv := c.ServerName()
 
 				if srv == param {
@@ -199,39 +275,24 @@ func init() {
 					return
 				}
 
-				nogrp := true
-				groups, ok := ConfKey("groups").(map[interface{}]interface{})
-				if ok {
-					for grp := range groups {
-						name, ok := grp.(string)
-						if !ok {
-							continue
-						}
-
-						if name == param {
-							nogrp = false
-						}
-					}
-				}
-
-				if servers[param] == nil && nogrp {
+				if _, ok := conf.Servers[param]; !ok && !conf.IsGroup(param) {
 					c.SendChatMsg("Unknown servername " + param)
 					return
 				}
 
 				reqprivs := make(map[string]bool)
 
-				reqpriv, ok := ConfKey("servers:" + param + ":priv").(string)
-				if ok {
+				reqpriv := conf.Servers[param].Priv
+				if reqpriv != "" {
 					reqprivs[reqpriv] = true
 				}
 
-				reqpriv, ok = ConfKey("group_privs:" + param).(string)
-				if ok {
+				if grppriv := conf.GroupPrivs[param]; grppriv != "" {
+					reqpriv = grppriv
 					reqprivs[reqpriv] = true
 				}
 
-				allow, err := c.CheckPrivs(reqprivs)
+				allow, err := CheckPrivsOn(c.Username(), param, reqprivs)
 				if err != nil {
 					log.Print(err)
 					c.SendChatMsg("An internal error occured while attempting to check your privileges.")
@@ -285,23 +346,215 @@ func init() {
 			}
 		})
 
+	RegisterChatCommand("lastlogin",
+		"Prints when and from which IP address a player last logged in and when the account was first used. Usage: lastlogin <playername>",
+		privs("addr"),
+		true,
+		func(c *Conn, param string) {
+			if param == "" {
+				SendChatMsg(c, "Usage: lastlogin <playername>")
+				return
+			}
+
+			a, err := PlayerActivity(param)
+			if err != nil {
+				log.Print(err)
+				SendChatMsg(c, "An internal error occured while attempting to read the activity of the player.")
+				return
+			}
+
+			if a == nil {
+				SendChatMsg(c, "Unknown player "+param)
+				return
+			}
+
+			if a.LastLogin.IsZero() {
+				SendChatMsg(c, param+" has not logged in since activity is recorded.")
+				return
+			}
+
+			SendChatMsg(c, param+" last logged in at "+a.LastLogin.Format(activityTimeFormat)+" from "+a.LastAddr+
+				". First login: "+a.FirstLogin.Format(activityTimeFormat))
+		})
+
+	RegisterChatCommand("playtime",
+		"Prints how long a player has played in total. Usage: playtime <playername>",
+		nil,
+		true,
+		func(c *Conn, param string) {
+			if param == "" {
+				SendChatMsg(c, "Usage: playtime <playername>")
+				return
+			}
+
+			a, err := PlayerActivity(param)
+			if err != nil {
+				log.Print(err)
+				SendChatMsg(c, "An internal error occured while attempting to read the activity of the player.")
+				return
+			}
+
+			if a == nil {
+				SendChatMsg(c, "Unknown player "+param)
+				return
+			}
+
+			SendChatMsg(c, param+" has played for "+a.Playtime.Round(time.Second).String())
+		})
+
 	RegisterChatCommand("end",
 		"Kicks all connected clients and stops the proxy. Usage: end",
 		privs("end"),
 		true,
 		func(c *Conn, param string) {
+			Audit(actorName(c), "end", "", "")
 			End(false, false)
 		})
 
+	RegisterChatCommand("reload",
+		"Reloads the configuration file. Usage: reload",
+		privs("reload"),
+		true,
+		func(c *Conn, param string) {
+			if err := ReloadConfig(); err != nil {
+				log.Print(err)
+				SendChatMsg(c, "Could not reload the configuration: "+err.Error())
+				return
+			}
+
+			Audit(actorName(c), "reload", "", "")
+
+			SendChatMsg(c, "Configuration reloaded.")
+		})
+
+	RegisterChatCommand("rotatepassphrase",
+		"Changes the passwords multiserver uses to log into the minetest servers. Passwords of players that are not connected are changed when they join. Usage: rotatepassphrase",
+		privs("passphrase"),
+		true,
+		func(c *Conn, param string) {
+			gen, err := RotatePassphrase()
+			if err != nil {
+				log.Print(err)
+				SendChatMsg(c, "An internal error occured while attempting to rotate the passphrase.")
+				return
+			}
+
+			log.Print(actorName(c) + " rotated the passphrase to generation " + strconv.Itoa(gen))
+			Audit(actorName(c), "rotatepassphrase", "", strconv.Itoa(gen))
+			SendChatMsg(c, "Rotating passwords to generation "+strconv.Itoa(gen))
+		})
+
+	RegisterChatCommand("import-auth",
+		"Imports the accounts and privileges of a minetest auth.sqlite or auth.txt database. Console only. Usage: import-auth <path>",
+		privs("privs"),
+		true,
+		func(c *Conn, param string) {
+			if c != nil {
+				c.SendChatMsg("This command can only be used from the console.")
+				return
+			}
+
+			if param == "" {
+				log.Print("Usage: import-auth <path>")
+				return
+			}
+
+			Audit(actorName(c), "import-auth", "", param)
+
+			r, err := ImportAuth(param)
+			if r != nil {
+				for _, line := range strings.Split(r.String(), "\n") {
+					log.Print(line)
+				}
+			}
+
+			if err != nil {
+				log.Print(err)
+			}
+		})
+
+	RegisterChatCommand("export",
+		"Exports accounts, privileges, bans and storage entries to a JSON file. Console only. Usage: export <path>",
+		privs("privs"),
+		true,
+		func(c *Conn, param string) {
+			if c != nil {
+				c.SendChatMsg("This command can only be used from the console.")
+				return
+			}
+
+			if param == "" {
+				log.Print("Usage: export <path>")
+				return
+			}
+
+			if err := ExportFile(param); err != nil {
+				log.Print(err)
+				return
+			}
+
+			Audit(actorName(c), "export", "", param)
+
+			log.Print("Exported to " + param)
+		})
+
+	RegisterChatCommand("import",
+		"Imports accounts, privileges, bans and storage entries from a JSON file created by export. Console only. "+
+			"A different passphrase for the minetest servers is only imported with -force. Usage: import [-force] <path>",
+		privs("privs"),
+		true,
+		func(c *Conn, param string) {
+			if c != nil {
+				c.SendChatMsg("This command can only be used from the console.")
+				return
+			}
+
+			force := strings.HasPrefix(param, "-force ")
+			if force {
+				param = strings.TrimSpace(strings.TrimPrefix(param, "-force "))
+			}
+
+			if param == "" {
+				log.Print("Usage: import [-force] <path>")
+				return
+			}
+
+			if err := ImportFile(param, force); err != nil {
+				log.Print(err)
+				if errors.Is(err, ErrPassphraseChange) {
+					log.Print("Use import -force <path> to replace it")
+				}
+				return
+			}
+
+			Audit(actorName(c), "import", "", param)
+
+			log.Print("Imported " + param)
+		})
+
 	RegisterChatCommand("privs",
 		`Prints your privileges if executed without arguments. 
-		Prints a connected player's privileges if executed with arguments. Usage: privs [playername]`,
+		Prints a connected player's privileges if executed with arguments. 
+		Privileges scoped to a server or group are shown with their @server or @group suffix. 
+		If a server or group is specified, only the privileges that apply there are shown. Usage: privs [playername] [@server | @group]`,
 		nil,
 		true,
 		func(c *Conn, param string) {
 			var r string
 
-			name := param
+			var scope string
+			params := strings.Split(param, " ")
+			if strings.HasPrefix(params[len(params)-1], "@") {
+				scope = strings.TrimPrefix(params[len(params)-1], "@")
+				params = params[:len(params)-1]
+
+				if !validPrivScope(scope) {
+					SendChatMsg(c, "Unknown server or group "+scope+".")
+					return
+				}
+			}
+
+			name := strings.Join(params, " ")
 			if name == "" {
 				if c == nil {
 					log.Print("Cannot read privileges of console!")
@@ -309,25 +562,50 @@ func init() {
 				}
 
 				name = c.Username()
-				r += "Your privileges: "
+				r += "Your privileges"
 			} else {
-				r += name + "'s privileges: "
+				r += name + "'s privileges"
+			}
+
+			if scope != "" {
+				r += " on " + scope
+			}
+			r += ": "
+
+			var privs map[string]bool
+			var err error
+			if scope != "" {
+				privs, err = PrivsOn(name, scope)
+			} else {
+				privs, err = EffectivePrivs(name)
 			}
 
-			privs, err := Privs(name)
 			if err != nil {
 				log.Print(err)
 				SendChatMsg(c, "An internal error occured while attempting to get the privileges.")
 				return
 			}
 
+			roles, err := Roles(name)
+			if err != nil {
+				log.Print(err)
+				SendChatMsg(c, "An internal error occured while attempting to get the roles.")
+				return
+			}
+
 			eprivs := encodePrivs(privs)
+			r += strings.Replace(eprivs, "|", " ", -1)
 
-			SendChatMsg(c, r+strings.Replace(eprivs, "|", " ", -1))
+			if len(roles) > 0 {
+				r += " (roles: " + strings.Replace(encodePrivs(roles), "|", " ", -1) + ")"
+			}
+
+			SendChatMsg(c, r)
 		})
 
 	RegisterChatCommand("grant",
 		`Grants privileges to a connected player. The privileges need to be comma-seperated. 
+		Append @server or @group to a privilege to grant it only on that server or server group. 
 		If the playername is omitted, privileges are granted to you. Usage: grant [playername] <privileges>`,
 		privs("privs"),
 		true,
@@ -356,9 +634,18 @@ func init() {
 
 			splitprivs := strings.Split(strings.Replace(privnames, " ", "", -1), ",")
 			for i := range splitprivs {
+				if _, scope := splitPriv(splitprivs[i]); scope != "" && !validPrivScope(scope) {
+					SendChatMsg(c, "Unknown server or group "+scope+".")
+					return
+				}
+
 				privs[splitprivs[i]] = true
 			}
 
+			if !allowedToChangePrivs(c, splitprivs) {
+				return
+			}
+
 			err = SetPrivs(name, privs)
 			if err != nil {
 				log.Print(err)
@@ -366,11 +653,14 @@ func init() {
 				return
 			}
 
+			Audit(actorName(c), "grant", name, strings.Join(splitprivs, ","))
+
 			SendChatMsg(c, "Privileges updated.")
 		})
 
 	RegisterChatCommand("revoke",
 		`Revokes privileges from a connected player. The privileges need to be comma-seperated. 
+		Scoped privileges are revoked using the same @server or @group suffix they were granted with. 
 		If the playername is omitted, privileges are revoked from you. Usage: revoke [playername] <privileges>`,
 		privs("privs"),
 		true,
@@ -402,6 +692,10 @@ func init() {
 				privs[splitprivs[i]] = false
 			}
 
+			if !allowedToChangePrivs(c, splitprivs) {
+				return
+			}
+
 			err = SetPrivs(name, privs)
 			if err != nil {
 				log.Print(err)
@@ -409,23 +703,130 @@ func init() {
 				return
 			}
 
+			Audit(actorName(c), "revoke", name, strings.Join(splitprivs, ","))
+
+			// Privileges granted by roles can't be revoked individually
+			eff, err := EffectivePrivs(name)
+			if err != nil {
+				log.Print(err)
+				return
+			}
+
+			var kept []string
+			for _, priv := range splitprivs {
+				if eff[priv] {
+					kept = append(kept, priv)
+				}
+			}
+
+			if len(kept) > 0 {
+				SendChatMsg(c, "Privileges updated. "+name+" keeps "+strings.Join(kept, " ")+" through roles.")
+				return
+			}
+
 			SendChatMsg(c, "Privileges updated.")
 		})
 
+	RegisterChatCommand("role",
+		`Adds a player to or removes a player from a role defined in the configuration. 
+		Lists the roles and their privileges if executed without a playername. Usage: role <add | remove> <playername> <role> | role list`,
+		privs("privs"),
+		true,
+		func(c *Conn, param string) {
+			params := strings.Split(param, " ")
+			usage := "Usage: role <add | remove> <playername> <role> | role list"
+
+			switch params[0] {
+			case "add", "remove":
+				if len(params) != 3 || params[1] == "" || params[2] == "" {
+					SendChatMsg(c, usage)
+					return
+				}
+
+				roles, err := Roles(params[1])
+				if err != nil {
+					log.Print(err)
+					SendChatMsg(c, "An internal error occured while attempting to get the roles.")
+					return
+				}
+
+				roles[params[2]] = params[0] == "add"
+
+				if err := SetRoles(params[1], roles); err != nil {
+					log.Print(err)
+					SendChatMsg(c, "Could not change the roles of "+params[1]+": "+err.Error())
+					return
+				}
+
+				log.Print(actorName(c) + " role " + params[0] + " " + params[1] + " " + params[2])
+				Audit(actorName(c), "role "+params[0], params[1], params[2])
+
+				SendChatMsg(c, "Roles updated.")
+			case "list":
+				roles := Conf().Roles
+				if len(roles) == 0 {
+					SendChatMsg(c, "No roles are defined.")
+					return
+				}
+
+				var names []string
+				for role := range roles {
+					names = append(names, role)
+				}
+				sort.Strings(names)
+
+				msg := "Role | Privileges\n"
+				for _, role := range names {
+					msg += role + " | " + strings.Join(roles[role], " ") + "\n"
+				}
+
+				SendChatMsg(c, msg)
+			default:
+				SendChatMsg(c, usage)
+			}
+		})
+
 	RegisterChatCommand("banlist",
-		"Prints the list of banned IP address and associated players. Usage: banlist",
+		"Prints the list of banned IP addresses and accounts. Usage: banlist",
 		privs("ban"),
 		true,
 		func(c *Conn, param string) {
-			bans, err := BanList()
+			bans, err := Auth().Bans()
+			if err != nil {
+				SendChatMsg(c, "An internal error occured while attempting to read the ban list.")
+				return
+			}
+
+			nameBans, err := Auth().NameBans()
 			if err != nil {
 				SendChatMsg(c, "An internal error occured while attempting to read the ban list.")
 				return
 			}
 
-			msg := "Address | Name\n"
-			for addr, name := range bans {
-				msg += addr + " | " + name + "\n"
+			expires := func(b BanEntry) string {
+				if b.Expires.IsZero() {
+					return "never"
+				}
+
+				return b.Expires.Format(activityTimeFormat)
+			}
+
+			msg := "IP bans:\nAddress | Name | Expires | Issuer | Reason\n"
+			for _, b := range bans {
+				msg += b.Addr + " | " + b.Name + " | " + expires(b) + " | " + b.Issuer + " | " + b.Reason + "\n"
+			}
+
+			msg += "Name bans:\nName | Expires | Issuer | Reason\n"
+			for _, b := range nameBans {
+				msg += b.Name + " | " + expires(b) + " | " + b.Issuer + " | " + b.Reason + "\n"
+			}
+
+			files := BanFiles()
+			if len(files) > 0 {
+				msg += "Ban files:\n"
+				for path, n := range files {
+					msg += path + " | " + strconv.Itoa(n) + " ranges\n"
+				}
 			}
 
 			SendChatMsg(c, msg)
@@ -445,7 +846,12 @@ func init() {
 			r := "Kicked. " + strings.Join(strings.Split(param, " ")[1:], " ") + "."
 
 			if c2 := ConnByUsername(name); c2 != nil {
+				if !allowedOn(c, c2.ServerName(), privs("kick")) {
+					return
+				}
+
 				c2.CloseWith(AccessDeniedCustomString, r, false)
+				Audit(actorName(c), "kick", name, strings.Join(strings.Split(param, " ")[1:], " "))
 				SendChatMsg(c, "Kicked "+name)
 			} else {
 				SendChatMsg(c, name+" is not online.")
@@ -453,48 +859,379 @@ func init() {
 		})
 
 	RegisterChatCommand("ban",
-		"Bans an IP address or a connected player. Usage: ban <playername | IP address>",
+		"Bans the IP address of a connected player, an IP address or a CIDR range, or bans an account regardless of the address. The duration is permanent if omitted, e.g. 30m, 12h, 7d or 1w2d. Usage: ban <ip <playername | IP address | CIDR range> | name <playername>> [duration] [reason]",
 		privs("ban"),
 		true,
+		func(c *Conn, param string) {
+			usage := "Usage: ban <ip <playername | IP address | CIDR range> | name <playername>> [duration] [reason]"
+
+			params := strings.SplitN(param, " ", 2)
+			if len(params) != 2 {
+				SendChatMsg(c, usage)
+				return
+			}
+
+			target, d, reason, err := parseBanParams(params[1])
+			if err != nil {
+				SendChatMsg(c, "Could not ban "+target+": "+err.Error()+". "+usage)
+				return
+			}
+
+			switch params[0] {
+			case "ip":
+				err = banTarget(target, d, reason, actorName(c))
+			case "name":
+				err = BanName(target, d, reason, actorName(c))
+			default:
+				SendChatMsg(c, usage)
+				return
+			}
+
+			if err != nil {
+				SendChatMsg(c, "Could not ban "+target+": "+err.Error())
+				return
+			}
+
+			Audit(actorName(c), "ban "+params[0], target, strings.Join(strings.Split(params[1], " ")[1:], " "))
+
+			msg := "Banned " + params[0] + " " + target
+			if d > 0 {
+				msg += " for " + formatDuration(d)
+			}
+
+			SendChatMsg(c, msg)
+		})
+
+	RegisterChatCommand("unban",
+		"Removes the IP bans of an IP address, a CIDR range or a playername, or the ban of an account. Usage: unban <ip <playername | IP address | CIDR range> | name <playername>>",
+		privs("ban"),
+		true,
+		func(c *Conn, param string) {
+			params := strings.Split(param, " ")
+			if len(params) != 2 {
+				SendChatMsg(c, "Usage: unban <ip <playername | IP address | CIDR range> | name <playername>>")
+				return
+			}
+
+			var err error
+			switch params[0] {
+			case "ip":
+				err = Unban(params[1])
+			case "name":
+				err = UnbanName(params[1])
+			default:
+				SendChatMsg(c, "Usage: unban <ip <playername | IP address | CIDR range> | name <playername>>")
+				return
+			}
+
+			if err != nil {
+				SendChatMsg(c, "An internal error occured while attempting to unban the player.")
+				return
+			}
+
+			Audit(actorName(c), "unban "+params[0], params[1], "")
+
+			SendChatMsg(c, "Unbanned "+params[0]+" "+params[1])
+		})
+
+	RegisterChatCommand("mute",
+		"Prevents a player from sending chat messages. The duration is permanent if omitted, e.g. 30m, 12h, 7d or 1w2d. Usage: mute <playername> [duration] [reason]",
+		privs("mute"),
+		true,
 		func(c *Conn, param string) {
 			if param == "" {
-				SendChatMsg(c, "Usage: ban <playername | IP address>")
+				SendChatMsg(c, "Usage: mute <playername> [duration] [reason]")
+				return
+			}
+
+			name, d, reason, err := parseBanParams(param)
+			if err != nil {
+				SendChatMsg(c, "Could not mute "+name+": "+err.Error()+".")
+				return
+			}
+
+			if err := MuteFor(name, d, reason, actorName(c)); err != nil {
+				SendChatMsg(c, "Could not mute "+name+": "+err.Error())
+				return
+			}
+
+			log.Print(actorName(c) + " muted " + name)
+			Audit(actorName(c), "mute", name, strings.Join(strings.Split(param, " ")[1:], " "))
+
+			msg := "Muted " + name
+			if d > 0 {
+				msg += " for " + formatDuration(d)
+			}
+
+			SendChatMsg(c, msg)
+		})
+
+	RegisterChatCommand("unmute",
+		"Allows a muted player to send chat messages again. Usage: unmute <playername>",
+		privs("mute"),
+		true,
+		func(c *Conn, param string) {
+			if param == "" || strings.Contains(param, " ") {
+				SendChatMsg(c, "Usage: unmute <playername>")
+				return
+			}
+
+			if err := Unmute(param); err != nil {
+				log.Print(err)
+				SendChatMsg(c, "An internal error occured while attempting to unmute the player.")
+				return
+			}
+
+			log.Print(actorName(c) + " unmuted " + param)
+			Audit(actorName(c), "unmute", param, "")
+
+			SendChatMsg(c, "Unmuted "+param)
+		})
+
+	RegisterChatCommand("deluser",
+		"Deletes the account, the privileges and the last server of a player. Usage: deluser <playername>",
+		privs("accounts"),
+		true,
+		func(c *Conn, param string) {
+			if param == "" {
+				SendChatMsg(c, "Usage: deluser <playername>")
+				return
+			}
+
+			if err := DeleteAccount(param); err != nil {
+				if !errors.Is(err, ErrUnknownUser) {
+					log.Print(err)
+				}
+
+				SendChatMsg(c, "Could not delete "+param+": "+err.Error())
+				return
+			}
+
+			log.Print(actorName(c) + " deleted the account " + param)
+			Audit(actorName(c), "deluser", param, "")
+			SendChatMsg(c, "Deleted "+param)
+		})
+
+	RegisterChatCommand("rename",
+		`Renames an account including its privileges and bans. 
+		A new password is required if the name changes in more than case. Usage: rename <playername> <new playername> [new password]`,
+		privs("accounts"),
+		true,
+		func(c *Conn, param string) {
+			params := strings.SplitN(param, " ", 3)
+			if len(params) < 2 || params[0] == "" || params[1] == "" {
+				SendChatMsg(c, "Usage: rename <playername> <new playername> [new password]")
+				return
+			}
+
+			var password string
+			if len(params) == 3 {
+				password = params[2]
+			}
+
+			if err := RenameAccount(params[0], params[1], password); err != nil {
+				if !errors.Is(err, ErrUnknownUser) && !errors.Is(err, ErrUserExists) && !errors.Is(err, ErrPasswordRequired) {
+					log.Print(err)
+				}
+
+				SendChatMsg(c, "Could not rename "+params[0]+": "+err.Error())
+				return
+			}
+
+			log.Print(actorName(c) + " renamed the account " + params[0] + " to " + params[1])
+			Audit(actorName(c), "rename", params[0], params[1])
+			SendChatMsg(c, "Renamed "+params[0]+" to "+params[1])
+		})
+
+	RegisterChatCommand("setpassword",
+		"Sets a new password for a player. An empty password is only set with -empty and if empty passwords are allowed. "+
+			"Usage: setpassword <playername> <new password> | setpassword -empty <playername>",
+		privs("accounts"),
+		true,
+		func(c *Conn, param string) {
+			usage := "Usage: setpassword <playername> <new password> | setpassword -empty <playername>"
+
+			params := strings.SplitN(param, " ", 2)
+			if len(params) != 2 || params[0] == "" || params[1] == "" {
+				SendChatMsg(c, usage)
 				return
 			}
 
-			err := Ban(param, "not known")
+			var password string
+			if params[0] == "-empty" {
+				if strings.Contains(params[1], " ") {
+					SendChatMsg(c, usage)
+					return
+				}
+
+				params[0] = params[1]
+			} else {
+				password = params[1]
+			}
+
+			if err := ResetPassword(params[0], password); err != nil {
+				if !errors.Is(err, ErrUnknownUser) {
+					log.Print(err)
+				}
+
+				SendChatMsg(c, "Could not set the password of "+params[0]+": "+err.Error())
+				return
+			}
+
+			log.Print(actorName(c) + " set the password of " + params[0])
+			Audit(actorName(c), "setpassword", params[0], "")
+			SendChatMsg(c, "Set the password of "+params[0])
+		})
+
+	RegisterChatCommand("collisions",
+		"Lists the accounts whose names only differ in case. Usage: collisions",
+		privs("accounts"),
+		true,
+		func(c *Conn, param string) {
+			collisions, err := NameCollisions()
 			if err != nil {
-				c2 := ConnByUsername(param)
-				if c2 == nil {
-					SendChatMsg(c, param+" is not online.")
+				log.Print(err)
+				SendChatMsg(c, "An internal error occured while attempting to read the accounts.")
+				return
+			}
+
+			if len(collisions) == 0 {
+				SendChatMsg(c, "There are no colliding accounts.")
+				return
+			}
+
+			var lowers []string
+			for lower := range collisions {
+				lowers = append(lowers, lower)
+			}
+			sort.Strings(lowers)
+
+			for _, lower := range lowers {
+				SendChatMsg(c, strings.Join(collisions[lower], ", "))
+			}
+		})
+
+	RegisterChatCommand("whitelist",
+		"Adds a player to or removes a player from the whitelist or lists the whitelisted players. Usage: whitelist <add | remove> <playername> | whitelist list",
+		privs("whitelist"),
+		true,
+		func(c *Conn, param string) {
+			params := strings.Split(param, " ")
+			usage := "Usage: whitelist <add | remove> <playername> | whitelist list"
+
+			switch params[0] {
+			case "add", "remove":
+				if len(params) != 2 || params[1] == "" {
+					SendChatMsg(c, usage)
+					return
+				}
+
+				var err error
+				if params[0] == "add" {
+					err = Auth().WhitelistAdd(params[1])
+				} else {
+					err = Auth().WhitelistRemove(params[1])
+				}
+
+				if err != nil {
+					log.Print(err)
+					SendChatMsg(c, "An internal error occured while attempting to change the whitelist.")
 					return
 				}
 
-				if err := c2.Ban(); err != nil {
-					SendChatMsg(c, "An internal error occured while attempting to ban the player.")
+				log.Print(actorName(c) + " whitelist " + params[0] + " " + params[1])
+				Audit(actorName(c), "whitelist "+params[0], params[1], "")
+
+				if params[0] == "add" {
+					SendChatMsg(c, "Added "+params[1]+" to the whitelist.")
+				} else {
+					SendChatMsg(c, "Removed "+params[1]+" from the whitelist.")
+				}
+			case "list":
+				names, err := Auth().Whitelist()
+				if err != nil {
+					log.Print(err)
+					SendChatMsg(c, "An internal error occured while attempting to read the whitelist.")
 					return
 				}
+
+				if len(names) == 0 {
+					SendChatMsg(c, "The whitelist is empty.")
+					return
+				}
+
+				SendChatMsg(c, "Whitelist: "+strings.Join(names, " "))
+			default:
+				SendChatMsg(c, usage)
 			}
+		})
 
-			SendChatMsg(c, "Banned "+param)
+	RegisterChatCommand("lockouts",
+		"Lists the accounts and IP addresses that are locked out because of failed login attempts. Usage: lockouts",
+		privs("ban"),
+		true,
+		func(c *Conn, param string) {
+			lockouts := Lockouts()
+			if len(lockouts) == 0 {
+				SendChatMsg(c, "There are no lockouts.")
+				return
+			}
+
+			for _, l := range lockouts {
+				d := time.Until(l.Until).Round(time.Second)
+				SendChatMsg(c, l.ID+" is locked out for "+d.String()+" (lockout "+strconv.Itoa(l.Count)+")")
+			}
 		})
 
-	RegisterChatCommand("unban",
-		"Unbans an IP address or a playername. Usage: unban <playername | IP address>",
+	RegisterChatCommand("unlock",
+		"Clears the failed login attempts and the lockout of a playername or an IP address. Usage: unlock <playername | IP address>",
 		privs("ban"),
 		true,
 		func(c *Conn, param string) {
 			if param == "" {
-				SendChatMsg(c, "Usage: unban <playername | IP address>")
+				SendChatMsg(c, "Usage: unlock <playername | IP address>")
 				return
 			}
 
-			if err := Unban(param); err != nil {
-				SendChatMsg(c, "An internal error occured while attempting to unban the player.")
+			if !ClearLockout(param) {
+				SendChatMsg(c, param+" has no failed login attempts.")
 				return
 			}
 
-			SendChatMsg(c, "Unbanned "+param)
+			Audit(actorName(c), "unlock", param, "")
+
+			SendChatMsg(c, "Cleared the lockout of "+param)
+		})
+
+	RegisterChatCommand("audit",
+		"Prints the latest moderation and privilege changes, optionally only those issued by or affecting a player. Usage: audit [playername | rpc:servername]",
+		privs("audit"),
+		true,
+		func(c *Conn, param string) {
+			if strings.Contains(param, " ") {
+				SendChatMsg(c, "Usage: audit [playername | rpc:servername]")
+				return
+			}
+
+			entries, err := AuditLog(param, 20)
+			if err != nil {
+				log.Print(err)
+				SendChatMsg(c, "An internal error occured while attempting to read the audit log.")
+				return
+			}
+
+			if len(entries) == 0 {
+				SendChatMsg(c, "No entries found.")
+				return
+			}
+
+			msg := "Time | Actor | Action | Target | Arguments\n"
+			for i := len(entries) - 1; i >= 0; i-- {
+				e := entries[i]
+				msg += e.Time.Format(activityTimeFormat) + " | " + e.Actor + " | " + e.Action + " | " + e.Target + " | " + e.Args + "\n"
+			}
+
+			SendChatMsg(c, msg)
 		})
 
 	RegisterOnRedirectDone(func(c *Conn, newsrv string, success bool) {
@@ -8,7 +8,6 @@ import (
 	"io"
 	"log"
 	"net"
-	"regexp"
 	"strings"
 	"time"
 
@@ -45,6 +44,14 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 			log.Print(err)
 		}
 
+		// The password depends on the server and the generation
+		// of the password of the player on that server
+		srvName := Conf().ServerByAddr(c2.Addr().String())
+
+		var gen int
+		var secret []byte
+		var registered bool
+
 		for {
 			pkt, err := c2.Recv()
 			if err != nil {
@@ -72,8 +79,16 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 				authMech := ReadUint8(r)
 
 				if authMech&AuthMechSRP > 0 {
+					gen, err = passwordGeneration(srvName, c.Username())
+					if err != nil {
+						log.Print(err)
+						continue
+					}
+
+					secret = serverSecret(gen, srvName)
+
 					// Compute and send SRP_BYTES_A
-					_, _, err := srp.NewClient([]byte(strings.ToLower(c.Username())), passPhrase)
+					_, _, err := srp.NewClient([]byte(strings.ToLower(c.Username())), secret)
 					if err != nil {
 						log.Print(err)
 						continue
@@ -105,8 +120,19 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 					}
 					<-ack
 				} else {
+					// The player doesn't have an account on the server yet,
+					// use the current generation
+					gen, err = PassphraseGeneration()
+					if err != nil {
+						log.Print(err)
+						continue
+					}
+
+					secret = serverSecret(gen, srvName)
+					registered = true
+
 					// Compute and send s and v
-					s, v, err := srp.NewClient([]byte(strings.ToLower(c.Username())), passPhrase)
+					s, v, err := srp.NewClient([]byte(strings.ToLower(c.Username())), secret)
 					if err != nil {
 						log.Print(err)
 						continue
@@ -137,7 +163,7 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 				B := make([]byte, r.Len())
 				r.Read(B)
 
-				K, err := srp.CompleteHandshake(c.srp_A, c.srp_a, []byte(strings.ToLower(c.Username())), passPhrase, s, B)
+				K, err := srp.CompleteHandshake(c.srp_A, c.srp_a, []byte(strings.ToLower(c.Username())), secret, s, B)
 				if err != nil {
 					log.Print(err)
 					continue
@@ -164,14 +190,7 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 				<-ack
 			case ToClientAccessDenied:
 				// Auth failed for some reason
-				servers := ConfKey("servers").(map[interface{}]interface{})
-				var srv string
-				for server := range servers {
-					if ConfKey("servers:"+server.(string)+":address") == c2.Addr().String() {
-						srv = server.(string)
-						break
-					}
-				}
+				srv := Conf().ServerByAddr(c2.Addr().String())
 
 				log.Print("access denied by server " + srv)
 
@@ -187,6 +206,12 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 					fin <- c2
 				}()
 
+				if registered {
+					if err := setPasswordGeneration(srvName, c.Username(), gen); err != nil {
+						log.Print(err)
+					}
+				}
+
 				ack, err := c2.Send(rudp.Pkt{
 					Reader: bytes.NewReader([]byte{0, ToServerInit2, 0, 0}),
 					PktInfo: rudp.PktInfo{
@@ -227,6 +252,9 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 					continue
 				}
 
+				// Change outdated passwords now that sudo mode is possible
+				go c2.updatePassword(c.Username())
+
 				return
 			}
 		}
@@ -242,9 +270,7 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 						log.Print(c2.Addr().String(), " disconnected")
 					}
 
-					connectedConnsMu.Lock()
-					connectedConns--
-					connectedConnsMu.Unlock()
+					removeConnectedConn(c2)
 
 					processLeave(c2)
 
@@ -279,7 +305,7 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 
 				c2.protoVer = protov
 
-				if strict, ok := ConfKey("force_latest_proto").(bool); (ok && strict) && (protov != ProtoLatest) || protov < ProtoMin || protov > ProtoLatest {
+				if Conf().ForceLatestProto && (protov != ProtoLatest) || protov < ProtoMin || protov > ProtoLatest {
 					c2.CloseWith(AccessDeniedWrongVersion, "", false)
 					fin <- c
 					return
@@ -298,12 +324,7 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 					return
 				}
 
-				ok, err := regexp.MatchString(PlayerNameChars, c2.Username())
-				if err != nil {
-					log.Print(err)
-				}
-
-				if !ok || err != nil {
+				if !ValidPlayerName(c2.Username()) {
 					c2.CloseWith(AccessDeniedWrongCharsInName, "", false)
 					fin <- c
 					log.Print(c2.Addr().String() + " tried to connect with invalid name")
@@ -319,17 +340,55 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 				binary.BigEndian.PutUint16(data[5:7], uint16(protov))
 
 				// Check if user is banned
-				banned, bname, err := c2.IsBanned()
+				ban, err := c2.FindBan()
+				if err != nil {
+					log.Print(err)
+					continue
+				}
+
+				if ban != nil {
+					log.Print("Banned user " + ban.Name + " at " + c2.Addr().String() + " tried to connect")
+
+					c2.CloseWith(AccessDeniedCustomString, ban.Message(), false)
+					fin <- c
+					return
+				}
+
+				// Check if the account is banned
+				ban, err = FindNameBan(c2.Username())
+				if err != nil {
+					log.Print(err)
+					continue
+				}
+
+				if ban != nil {
+					log.Print("Banned account " + c2.Username() + " tried to connect from " + c2.Addr().String())
+
+					c2.CloseWith(AccessDeniedCustomString, ban.Message(), false)
+					fin <- c
+					return
+				}
+
+				// Check if user is on the whitelist
+				whitelisted, err := Auth().IsWhitelisted(c2.Username())
 				if err != nil {
 					log.Print(err)
 					continue
 				}
 
-				if banned {
-					log.Print("Banned user " + bname + " at " + c2.Addr().String() + " tried to connect")
+				if Conf().Whitelist && !whitelisted {
+					log.Print("User " + c2.Username() + " at " + c2.Addr().String() + " is not on the whitelist")
+
+					c2.CloseWith(AccessDeniedCustomString, "You are not on the whitelist.", false)
+					fin <- c
+					return
+				}
+
+				// Check if there have been too many failed attempts
+				if locked, until := c2.IsLockedOut(); locked {
+					log.Print("Locked out user " + c2.Username() + " at " + c2.Addr().String() + " tried to connect")
 
-					reason := "Your IP address is banned. Banned name is " + bname
-					c2.CloseWith(AccessDeniedCustomString, reason, false)
+					c2.CloseWith(AccessDeniedCustomString, lockoutReason(until), false)
 					fin <- c
 					return
 				}
@@ -356,6 +415,32 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 
 				if v == nil || s == nil {
 					// New player
+					// Names that only differ in case share the same
+					// SRP identity and must not be registered twice
+					existing, err := Auth().FindUser(c2.Username())
+					if err != nil {
+						log.Print(err)
+						continue
+					}
+
+					if existing != "" {
+						log.Print(c2.Addr().String() + " tried to register " + c2.Username() + " which collides with " + existing)
+
+						reason := "The name " + existing + " is already registered. Names are not case sensitive."
+						c2.CloseWith(AccessDeniedCustomString, reason, false)
+						fin <- c
+						return
+					}
+
+					// Whitelisted players may register if the whitelist is enabled
+					if !Conf().AllowNewPlayers && !(Conf().Whitelist && whitelisted) {
+						log.Print(c2.Addr().String() + " tried to register " + c2.Username() + " but allow_new_players is false")
+
+						c2.CloseWith(AccessDeniedCustomString, "This server does not accept new players.", false)
+						fin <- c
+						return
+					}
+
 					c2.authMech = AuthMechFirstSRP
 					binary.BigEndian.PutUint32(data[7:11], uint32(AuthMechFirstSRP))
 				} else {
@@ -391,8 +476,7 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 				empty := ReadUint8(r)
 
 				// Also make sure to check for an empty password
-				disallow, ok := ConfKey("disallow_empty_passwords").(bool)
-				if ok && disallow && empty > 0 {
+				if Conf().DisallowEmptyPasswords && empty > 0 {
 					log.Print(c2.Addr().String() + " used an empty password but disallow_empty_passwords is true")
 
 					c2.CloseWith(AccessDeniedEmptyPassword, "", false)
@@ -401,6 +485,15 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 				}
 
 				if err := CreateUser(c2.Username(), v, s); err != nil {
+					if errors.Is(err, ErrUserExists) {
+						// Registered concurrently with a name that only differs in case
+						log.Print(c2.Addr().String() + " tried to register " + c2.Username() + " which has been registered concurrently")
+
+						c2.CloseWith(AccessDeniedCustomString, "The name "+c2.Username()+" is already registered. Names are not case sensitive.", false)
+						fin <- c
+						return
+					}
+
 					log.Print(err)
 					continue
 				}
@@ -491,6 +584,8 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 
 				if subtle.ConstantTimeCompare(M, M2) == 1 {
 					// Password is correct
+					c2.AuthSucceeded()
+
 					// Send AUTH_ACCEPT
 					data := []byte{
 						0, ToClientAuthAccept,
@@ -517,6 +612,8 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 					// Client supplied wrong password
 					log.Print("User " + c2.Username() + " at " + c2.Addr().String() + " supplied wrong password")
 
+					c2.AuthFailed()
+
 					c2.CloseWith(AccessDeniedWrongPassword, "", false)
 					fin <- c
 					return
@@ -535,10 +632,11 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 					return
 				}
 
-				defaultSrv := ConfKey("default_server").(string)
+				conf := c2.ListenerConf()
+				defaultSrv := conf.DefaultServer
 
 				defSrv := func() *Conn {
-					defaultSrvAddr := ConfKey("servers:" + defaultSrv + ":address").(string)
+					defaultSrvAddr := conf.Servers[defaultSrv].Address
 
 					srvaddr, err := net.ResolveUDPAddr("udp", defaultSrvAddr)
 					if err != nil {
@@ -567,20 +665,23 @@ func Init(c, c2 *Conn, ignMedia, noAccessDenied bool, fin chan *Conn) {
 					return srv
 				}
 
-				if forceDefaultServer, ok := ConfKey("force_default_server").(bool); !forceDefaultServer || !ok {
+				if !conf.ForceDefaultServer {
 					srvname, err := StorageKey("server:" + c2.Username())
 					if err != nil {
-						srvname, ok = ConfKey("servers:" + ConfKey("default_server").(string) + ":address").(string)
-						if !ok {
-							go c2.SendChatMsg("Could not connect you to your last server!")
+						go c2.SendChatMsg("Could not connect you to your last server!")
 
-							fin <- defSrv()
-							return
-						}
+						fin <- defSrv()
+						return
+					}
+
+					// The last server may belong to another listener
+					if !conf.ReachesServer(srvname) {
+						fin <- defSrv()
+						return
 					}
 
-					straddr, ok := ConfKey("servers:" + srvname + ":address").(string)
-					if !ok {
+					straddr := conf.Servers[srvname].Address
+					if straddr == "" {
 						go c2.SendChatMsg("Could not connect you to your last server!")
 
 						fin <- defSrv()
@@ -13,14 +13,41 @@ var ErrPlayerLimitReached = errors.New("player limit reached")
 
 type Listener struct {
 	*rudp.Listener
+
+	host string
+}
+
+// listenNetwork returns the network to listen on for a host
+// IP literals only accept their own address family so that
+// e.g. 0.0.0.0 and [::] can be used at the same time,
+// host names and empty hosts are dual-stack
+func listenNetwork(host string) string {
+	h, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return "udp"
+	}
+
+	ip := net.ParseIP(h)
+	if ip == nil {
+		return "udp"
+	}
+
+	if ip.To4() != nil {
+		return "udp4"
+	}
+
+	return "udp6"
 }
 
 var connMu sync.RWMutex
 var conns map[*Conn]struct{}
 
-func Listen(conn net.PacketConn) *Listener {
+// Listen returns a Listener for the host entry of the configuration
+// conn is listening on
+func Listen(conn net.PacketConn, host string) *Listener {
 	return &Listener{
 		Listener: rudp.Listen(conn),
+		host:     host,
 	}
 }
 
@@ -33,7 +60,7 @@ func (l *Listener) Accept() (*Conn, error) {
 		return nil, err
 	}
 
-	clt := &Conn{Conn: rp}
+	clt := &Conn{Conn: rp, host: l.host}
 
 	connMu.Lock()
 	conns[clt] = struct{}{}
@@ -53,20 +80,11 @@ func (l *Listener) Accept() (*Conn, error) {
 	clt.sounds = make(map[int32]bool)
 	clt.inv = &mt.Inv{}
 
-	maxConns, ok := ConfKey("player_limit").(int)
-	if !ok {
-		maxConns = int(^uint(0) >> 1)
-	}
-
-	if ConnCount() >= maxConns {
+	if !addConnectedConn(clt) {
 		clt.CloseWith(AccessDeniedTooManyUsers, "", true)
 		return nil, ErrPlayerLimitReached
 	}
 
-	connectedConnsMu.Lock()
-	connectedConns++
-	connectedConnsMu.Unlock()
-
 	return clt, nil
 }
 
@@ -85,6 +103,15 @@ func ConnByUsername(name string) *Conn {
 	return nil
 }
 
+// ListenerConnCount returns the number of client Conns
+// that have connected to the listener on host
+func ListenerConnCount(host string) int {
+	connectedConnsMu.RLock()
+	defer connectedConnsMu.RUnlock()
+
+	return listenerConns[host]
+}
+
 // Conns returns an array containing all connected client Conns
 func Conns() []*Conn {
 	connMu.RLock()
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Lockout holds the failed login attempts of an account or IP address
+type Lockout struct {
+	// ID is the name of the account or the IP address
+	ID string
+	// Failures is the number of failed attempts since the last lockout
+	Failures int
+	// Count is the number of lockouts in a row
+	Count int
+	// Until is the end of the current lockout
+	Until time.Time
+
+	last time.Time
+}
+
+// Locked reports whether the lockout is in effect
+func (l *Lockout) Locked() bool {
+	return time.Now().Before(l.Until)
+}
+
+var accountLockouts = make(map[string]*Lockout)
+var addrLockouts = make(map[string]*Lockout)
+var lastLockoutPrune time.Time
+var lockoutMu sync.Mutex
+
+// expire forgets failed attempts that are older than auth_lockout_max_time
+func (l *Lockout) expire(now time.Time) bool {
+	maxTime := time.Duration(Conf().AuthLockoutMaxTime) * time.Second
+	return !now.Before(l.Until) && now.Sub(l.last) >= maxTime
+}
+
+// fail records a failed attempt and starts a lockout
+// once max attempts have failed
+// The duration of the lockout doubles with every lockout
+func (l *Lockout) fail(max int, now time.Time) {
+	l.Failures++
+	l.last = now
+
+	if max <= 0 || l.Failures < max {
+		return
+	}
+
+	l.Failures = 0
+	l.Count++
+
+	conf := Conf()
+	d := time.Duration(conf.AuthLockoutTime) * time.Second
+	maxTime := time.Duration(conf.AuthLockoutMaxTime) * time.Second
+	for i := 1; i < l.Count && d < maxTime; i++ {
+		d *= 2
+	}
+
+	if d > maxTime {
+		d = maxTime
+	}
+
+	l.Until = now.Add(d)
+}
+
+func lockoutAddr(c *Conn) string {
+	return c.IP().String()
+}
+
+// IsLockedOut reports whether logins to an account or from the address
+// of a Conn are locked out and returns when the lockout ends
+func (c *Conn) IsLockedOut() (bool, time.Time) {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	var until time.Time
+	for _, l := range []*Lockout{accountLockouts[c.Username()], addrLockouts[lockoutAddr(c)]} {
+		if l != nil && l.Locked() && l.Until.After(until) {
+			until = l.Until
+		}
+	}
+
+	return !until.IsZero(), until
+}
+
+// lockoutReason returns the AccessDeniedCustomString reason
+// for a lockout that ends at until
+func lockoutReason(until time.Time) string {
+	d := time.Until(until).Round(time.Second)
+	if d < time.Second {
+		d = time.Second
+	}
+
+	return fmt.Sprintf("Too many failed login attempts. Try again in %s.", d)
+}
+
+// AuthFailed records a wrong password supplied by a Conn
+func (c *Conn) AuthFailed() {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	now := time.Now()
+	conf := Conf()
+
+	record := func(m map[string]*Lockout, id string, max int) {
+		l := m[id]
+		if l == nil || l.expire(now) {
+			l = &Lockout{ID: id}
+			m[id] = l
+		}
+
+		l.fail(max, now)
+	}
+
+	record(accountLockouts, c.Username(), conf.AuthMaxFailures)
+	record(addrLockouts, lockoutAddr(c), conf.AuthMaxFailuresIP)
+
+	if now.Sub(lastLockoutPrune) >= time.Minute {
+		pruneLockouts(now)
+		lastLockoutPrune = now
+	}
+}
+
+// pruneLockouts forgets expired failed attempts
+// lockoutMu must be locked by the caller
+func pruneLockouts(now time.Time) {
+	for _, m := range []map[string]*Lockout{accountLockouts, addrLockouts} {
+		for id, l := range m {
+			if l.expire(now) {
+				delete(m, id)
+			}
+		}
+	}
+}
+
+// AuthSucceeded resets the failed attempts of the account of a Conn
+// The failed attempts of the address are kept so that an attacker
+// can't reset them by logging into an account of their own
+func (c *Conn) AuthSucceeded() {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	delete(accountLockouts, c.Username())
+}
+
+// Lockouts returns the accounts and addresses that are locked out
+func Lockouts() []Lockout {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	pruneLockouts(time.Now())
+
+	var r []Lockout
+	for _, m := range []map[string]*Lockout{accountLockouts, addrLockouts} {
+		for _, l := range m {
+			if l.Locked() {
+				r = append(r, *l)
+			}
+		}
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].ID < r[j].ID
+	})
+
+	return r
+}
+
+// ClearLockout removes the failed attempts and the lockout
+// of an account or IP address
+// It reports whether there was anything to remove
+func ClearLockout(id string) bool {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	_, ok := accountLockouts[id]
+	_, ok2 := addrLockouts[id]
+
+	delete(accountLockouts, id)
+	delete(addrLockouts, id)
+
+	return ok || ok2
+}
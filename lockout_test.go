@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutEscalation(t *testing.T) {
+	conf := Conf()
+	lockoutTime := time.Duration(conf.AuthLockoutTime) * time.Second
+	maxTime := time.Duration(conf.AuthLockoutMaxTime) * time.Second
+
+	l := &Lockout{ID: "bob"}
+	now := time.Now()
+
+	for i, want := range []time.Duration{
+		lockoutTime,
+		2 * lockoutTime,
+		4 * lockoutTime,
+		8 * lockoutTime,
+		16 * lockoutTime,
+		32 * lockoutTime,
+		maxTime,
+		maxTime,
+	} {
+		if want > maxTime {
+			want = maxTime
+		}
+
+		for j := 0; j < 3; j++ {
+			if !l.Until.IsZero() && l.Until.After(now) {
+				t.Fatalf("lockout %d: locked out after %d of 3 failures", i+1, j)
+			}
+
+			l.fail(3, now)
+		}
+
+		if d := l.Until.Sub(now); d != want {
+			t.Errorf("lockout %d lasts %v, want %v", i+1, d, want)
+		}
+
+		if l.Failures != 0 || l.Count != i+1 {
+			t.Fatalf("lockout %d: Failures = %d, Count = %d", i+1, l.Failures, l.Count)
+		}
+
+		if i == 0 && l.expire(l.Until) {
+			t.Error("failures expired right after the first lockout ended")
+		}
+
+		now = l.Until
+	}
+
+	if !l.expire(now.Add(maxTime)) {
+		t.Error("failures didn't expire after auth_lockout_max_time")
+	}
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	l := &Lockout{ID: "192.0.2.1"}
+	for i := 0; i < 100; i++ {
+		l.fail(0, time.Now())
+	}
+
+	if l.Locked() || l.Count != 0 {
+		t.Fatalf("lockout with max 0: Locked = %v, Count = %d", l.Locked(), l.Count)
+	}
+}
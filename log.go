@@ -57,10 +57,10 @@ func (l *Logger) Write(p []byte) (int, error) {
 }
 
 func (l *Logger) Close() {
-	os.Mkdir("log", 0777)
+	os.MkdirAll(LogPath(""), 0777)
 
-	os.Rename("log/latest.txt", "log/last.txt")
-	os.WriteFile("log/latest.txt", l.all, 0666)
+	os.Rename(LogPath("latest.txt"), LogPath("last.txt"))
+	os.WriteFile(LogPath("latest.txt"), l.all, 0666)
 }
 
 func LogReady() <-chan struct{} {
@@ -71,7 +71,8 @@ func LogReady() <-chan struct{} {
 	return logReady
 }
 
-func init() {
+// initLog redirects the log to the curses console
+func initLog() {
 	l := newLogger()
 	log.SetOutput(l)
 
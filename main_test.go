@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain keeps the files of the tests out of the working directory
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "multiserver-test")
+	if err != nil {
+		panic(err)
+	}
+
+	os.Setenv("MULTISERVER_CONFIG", filepath.Join(dir, "config", "multiserver.yml"))
+	os.Setenv("MULTISERVER_DATA_DIR", filepath.Join(dir, "storage"))
+	os.Setenv("MULTISERVER_CACHE_DIR", filepath.Join(dir, "cache"))
+	os.Setenv("MULTISERVER_LOG_DIR", filepath.Join(dir, "log"))
+
+	code := m.Run()
+
+	closeDBs()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testMemBackends replaces the auth and storage backends
+// with empty in-memory ones for the duration of a test
+func testMemBackends(t *testing.T) {
+	authBackendMu.RLock()
+	auth := authBackend
+	authBackendMu.RUnlock()
+
+	storageBackendMu.RLock()
+	storage := storageBackend
+	storageBackendMu.RUnlock()
+
+	SetAuthBackend(NewMemAuthBackend())
+	SetStorageBackend(NewMemStorageBackend())
+
+	t.Cleanup(func() {
+		SetAuthBackend(auth)
+		SetStorageBackend(storage)
+	})
+}
+
+// testConf replaces the configuration with a modified copy
+// for the duration of a test
+func testConf(t *testing.T, modify func(c *Config)) {
+	old := Conf()
+
+	configMu.RLock()
+	raw := config
+	configMu.RUnlock()
+
+	c := *old
+	modify(&c)
+	setConfig(raw, &c)
+
+	t.Cleanup(func() { setConfig(raw, old) })
+}
+
+// testSQLite3 opens a migrated SQLite3 database for a test
+func testSQLite3(t *testing.T, name string, migrations []Migration) *DB {
+	db, err := OpenSQLite3(filepath.Base(t.Name())+"-"+name+".sqlite", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Migrate(name, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
@@ -50,42 +50,21 @@ func (c *Conn) fetchMedia() {
 
 		switch cmd := ReadUint16(r); cmd {
 		case ToClientNodeDef:
-			servers := ConfKey("servers").(map[interface{}]interface{})
-			var srvname string
-			for server := range servers {
-				if ConfKey("servers:"+server.(string)+":address") == c.Addr().String() {
-					srvname = server.(string)
-					break
-				}
-			}
+			srvname := Conf().ServerByAddr(c.Addr().String())
 
 			r.Seek(6, io.SeekStart)
 
 			nodedefs[srvname] = make([]byte, r.Len())
 			r.Read(nodedefs[srvname])
 		case ToClientItemDef:
-			servers := ConfKey("servers").(map[interface{}]interface{})
-			var srvname string
-			for server := range servers {
-				if ConfKey("servers:"+server.(string)+":address") == c.Addr().String() {
-					srvname = server.(string)
-					break
-				}
-			}
+			srvname := Conf().ServerByAddr(c.Addr().String())
 
 			r.Seek(6, io.SeekStart)
 
 			itemdefs[srvname] = make([]byte, r.Len())
 			r.Read(itemdefs[srvname])
 		case ToClientDetachedInventory:
-			servers := ConfKey("servers").(map[interface{}]interface{})
-			var srvname string
-			for server := range servers {
-				if ConfKey("servers:"+server.(string)+":address") == c.Addr().String() {
-					srvname = server.(string)
-					break
-				}
-			}
+			srvname := Conf().ServerByAddr(c.Addr().String())
 
 			inv := make([]byte, r.Len())
 			r.Read(inv)
@@ -170,11 +149,7 @@ func (c *Conn) updateDetachedInvs(srvname string) {
 }
 
 func (c *Conn) announceMedia() {
-	srvname, ok := ConfKey("default_server").(string)
-	if !ok {
-		log.Print("Default server name not set or not a string")
-		return
-	}
+	srvname := Conf().DefaultServer
 
 	data := make([]byte, 6+len(nodedef))
 	data[0] = uint8(0x00)
@@ -202,15 +177,8 @@ func (c *Conn) announceMedia() {
 
 	c.updateDetachedInvs(srvname)
 
-	csmrf, ok := ConfKey("csm_restriction_flags").(int)
-	if !ok {
-		csmrf = 0
-	}
-
-	csmnr, ok := ConfKey("csm_restriction_noderange").(int)
-	if !ok {
-		csmnr = 8
-	}
+	csmrf := Conf().CSMRestrictionFlags
+	csmnr := Conf().CSMRestrictionNoderange
 
 	data = make([]byte, 14)
 	data[0] = uint8(0x00)
@@ -232,11 +200,7 @@ func (c *Conn) announceMedia() {
 		WriteBytes16(w, media[f].digest)
 	}
 
-	remote, ok := ConfKey("remote_media_server").(string)
-	if !ok {
-		remote = ""
-	}
-	WriteBytes16(w, []byte(remote))
+	WriteBytes16(w, []byte(Conf().RemoteMediaServer))
 
 	ack, err = c.Send(rudp.Pkt{Reader: w})
 	if err != nil {
@@ -293,9 +257,9 @@ func (c *Conn) sendMedia(r *bytes.Reader) {
 }
 
 func loadMediaCache() error {
-	os.Mkdir("cache", 0777)
+	os.MkdirAll(CachePath(""), 0777)
 
-	files, err := os.ReadDir("cache")
+	files, err := os.ReadDir(CachePath(""))
 	if err != nil {
 		return err
 	}
@@ -304,11 +268,11 @@ func loadMediaCache() error {
 		if !file.IsDir() {
 			meta := strings.Split(file.Name(), "#")
 			if len(meta) != 2 {
-				os.Remove("cache/" + file.Name())
+				os.Remove(CachePath(file.Name()))
 				continue
 			}
 
-			data, err := os.ReadFile("cache/" + file.Name())
+			data, err := os.ReadFile(CachePath(file.Name()))
 			if err != nil {
 				continue
 			}
@@ -321,9 +285,9 @@ func loadMediaCache() error {
 }
 
 func isCached(name string, digest []byte) bool {
-	os.Mkdir("cache", 0777)
+	os.MkdirAll(CachePath(""), 0777)
 
-	_, err := os.Stat("cache/" + name + "#" + digestToString(digest))
+	_, err := os.Stat(CachePath(name + "#" + digestToString(digest)))
 	if os.IsNotExist(err) {
 		return false
 	}
@@ -331,14 +295,14 @@ func isCached(name string, digest []byte) bool {
 }
 
 func updateMediaCache() {
-	os.Mkdir("cache", 0777)
+	os.MkdirAll(CachePath(""), 0777)
 
 	for mfname, mfile := range media {
 		if mfile.noCache {
 			continue
 		}
 
-		cfname := "cache/" + mfname + "#" + digestToString(mfile.digest)
+		cfname := CachePath(mfname + "#" + digestToString(mfile.digest))
 		_, err := os.Stat(cfname)
 		if os.IsNotExist(err) {
 			os.WriteFile(cfname, mfile.data, 0666)
@@ -367,9 +331,9 @@ func loadMedia(servers map[string]struct{}) {
 	loadMediaCache()
 
 	for server := range servers {
-		straddr := ConfKey("servers:" + server + ":address")
+		straddr := Conf().Servers[server].Address
 
-		srvaddr, err := net.ResolveUDPAddr("udp", straddr.(string))
+		srvaddr, err := net.ResolveUDPAddr("udp", straddr)
 		if err != nil {
 			go func() {
 				<-LogReady()
@@ -423,18 +387,13 @@ func loadMedia(servers map[string]struct{}) {
 func init() {
 	nodedefs = make(map[string][]byte)
 	itemdefs = make(map[string][]byte)
+}
 
-	servers, ok := ConfKey("servers").(map[interface{}]interface{})
-	if !ok {
-		go func() {
-			<-LogReady()
-			log.Fatal("Server list inexistent or not a dictionary")
-		}()
-	}
-
+// initMedia loads the media of all configured servers
+func initMedia() {
 	srvs := make(map[string]struct{})
-	for server := range servers {
-		srvs[server.(string)] = struct{}{}
+	for server := range Conf().Servers {
+		srvs[server] = struct{}{}
 	}
 
 	loadMedia(srvs)
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// A Migration upgrades a database schema by one version
+// If PSQL is empty SQLite3 is used for PostgreSQL databases too
+type Migration struct {
+	SQLite3 string
+	PSQL    string
+}
+
+func (m Migration) sql(dbType int) string {
+	if dbType == DBTypePSQL && m.PSQL != "" {
+		return m.PSQL
+	}
+
+	return m.SQLite3
+}
+
+// SchemaVersion returns the version of a schema,
+// 0 means that no migrations have been applied yet
+func (db *DB) SchemaVersion(schema string) (int, error) {
+	if _, err := db.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+	name VARCHAR(32) PRIMARY KEY NOT NULL,
+	version INTEGER NOT NULL
+);`); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.QueryRow(`SELECT version FROM schema_version WHERE name = $1;`, schema).Scan(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Migrate applies the migrations of a schema that have not been applied yet
+// Every migration runs in its own transaction
+// An error is returned if the database has a newer schema than migrations
+func (db *DB) Migrate(schema string, migrations []Migration) error {
+	version, err := db.SchemaVersion(schema)
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("%s schema version %d is newer than the latest known version %d", schema, version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.DB.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[i].sql(db.Type())); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s schema migration %d: %w", schema, i+1, err)
+		}
+
+		if i == 0 {
+			_, err = tx.Exec(db.rebind(`INSERT INTO schema_version (
+	name,
+	version
+) VALUES (
+	$1,
+	$2
+);`), schema, i+1)
+		} else {
+			_, err = tx.Exec(db.rebind(`UPDATE schema_version SET version = $1 WHERE name = $2;`), i+1, schema)
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		log.Print("Migrated ", schema, " schema to version ", i+1)
+	}
+
+	return nil
+}
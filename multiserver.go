@@ -5,44 +5,64 @@ media and definition multiplexing
 package main
 
 import (
+	"flag"
 	"log"
 	"net"
 )
 
 func main() {
-	defaultSrv, ok := ConfKey("default_server").(string)
-	if !ok {
-		log.Fatal("Default server name not set or not a string")
-	}
+	parseFlags()
 
-	_, ok = ConfKey("servers:" + defaultSrv + ":address").(string)
-	if !ok {
-		log.Fatal("Default server address not set or not a string")
+	if flag.NArg() > 0 {
+		runSubcommand(flag.Args())
+		return
 	}
 
-	host, ok := ConfKey("host").(string)
-	if !ok {
-		host = "0.0.0.0:33000"
-	}
+	initChatCommands()
+	initLog()
+	initSignals()
 
-	lc, err := net.ListenPacket("udp", host)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer lc.Close()
+	initPassphrase()
 
-	log.Print("Listening on " + host)
+	// Open the auth backend now so that errors show up on startup
+	Auth()
+	grantAdminPrivs()
+	initBanFiles()
 
-	l := Listen(lc)
+	initMedia()
+	initRpc()
 
-	Announce(AnnounceStart)
+	// Every socket feeds the same accept loop
+	clts := make(chan *Conn)
+	for _, l := range Conf().Host {
+		host := l.Address
 
-	for {
-		clt, err := l.Accept()
+		lc, err := net.ListenPacket(listenNetwork(host), host)
 		if err != nil {
-			log.Print(err)
-			continue
+			log.Fatal(err)
 		}
+		defer lc.Close()
+
+		log.Print("Listening on " + host)
+
+		go func(l *Listener) {
+			for {
+				clt, err := l.Accept()
+				if err != nil {
+					log.Print(err)
+					continue
+				}
+
+				clts <- clt
+			}
+		}(Listen(lc, host))
+	}
+
+	Announce(AnnounceStart)
+	initAnnounce()
+
+	for {
+		clt := <-clts
 
 		log.Print(clt.Addr(), " connected")
 
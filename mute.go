@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Mute prevents a player from sending chat messages
+type Mute struct {
+	Name   string
+	Reason string
+	// Issuer is the player, console or RPC server that created the mute
+	Issuer  string
+	Created time.Time
+	// Expires is zero if the mute is permanent
+	Expires time.Time
+}
+
+// Expired reports whether a temporary mute is over
+func (m *Mute) Expired() bool {
+	return !m.Expires.IsZero() && !time.Now().Before(m.Expires)
+}
+
+// Message returns the reply to a chat message of a muted player
+func (m *Mute) Message() string {
+	msg := "You are muted"
+	if !m.Expires.IsZero() {
+		msg += " for another " + formatDuration(time.Until(m.Expires))
+	}
+	msg += "."
+
+	if m.Reason != "" {
+		msg += " Reason: " + m.Reason
+	}
+
+	return msg
+}
+
+// FindMute returns the mute of a player, nil if it isn't muted
+func FindMute(name string) (*Mute, error) {
+	return Auth().FindMute(name)
+}
+
+// IsMuted reports whether the player of a Conn is muted
+// and returns the mute
+func (c *Conn) IsMuted() (bool, *Mute, error) {
+	m, err := FindMute(c.Username())
+	if err != nil {
+		return true, nil, err
+	}
+
+	return m != nil, m, nil
+}
+
+// MuteFor mutes a player, the player doesn't need to be online
+// An existing mute is replaced
+// A duration of 0 means that the mute is permanent
+func MuteFor(name string, d time.Duration, reason, issuer string) error {
+	if !ValidPlayerName(name) {
+		return fmt.Errorf("invalid name %s", name)
+	}
+
+	m := &Mute{
+		Name:    name,
+		Reason:  reason,
+		Issuer:  issuer,
+		Created: time.Now(),
+	}
+
+	if d > 0 {
+		m.Expires = m.Created.Add(d)
+	}
+
+	if err := Auth().Mute(m); err != nil {
+		return err
+	}
+
+	if c := ConnByUsername(name); c != nil {
+		c.SendChatMsg(m.Message())
+	}
+
+	return nil
+}
+
+// Unmute removes the mute of a player
+func Unmute(name string) error {
+	if err := Auth().Unmute(name); err != nil {
+		return err
+	}
+
+	if c := ConnByUsername(name); c != nil {
+		c.SendChatMsg("You are no longer muted.")
+	}
+
+	return nil
+}
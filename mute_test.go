@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMuteExpiry(t *testing.T) {
+	testMemBackends(t)
+
+	c := &Conn{username: "bob"}
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name    string
+		expires time.Time
+		muted   bool
+	}{
+		{"permanent", time.Time{}, true},
+		{"running", now.Add(time.Hour), true},
+		{"expired", now.Add(-time.Second), false},
+	} {
+		if err := Auth().Mute(&Mute{Name: "bob", Created: now.Add(-time.Hour), Expires: tc.expires}); err != nil {
+			t.Fatal(err)
+		}
+
+		muted, m, err := c.IsMuted()
+		if err != nil || muted != tc.muted || (m != nil) != tc.muted {
+			t.Errorf("%s mute: IsMuted() = %v, %v, %v, want muted %v", tc.name, muted, m, err, tc.muted)
+		}
+	}
+
+	if err := MuteFor("bob", 10*time.Minute, "spam", "console"); err != nil {
+		t.Fatal(err)
+	}
+
+	if muted, m, err := c.IsMuted(); err != nil || !muted || m.Reason != "spam" || !m.Expires.After(now.Add(9*time.Minute)) {
+		t.Fatalf("IsMuted() after MuteFor = %v, %v, %v", muted, m, err)
+	}
+
+	if err := Unmute("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	if muted, _, err := c.IsMuted(); err != nil || muted {
+		t.Fatalf("IsMuted() after Unmute = %v, %v", muted, err)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HimbeerserverDE/srp"
+	"github.com/anon55555/mt/rudp"
+)
+
+// The passwords the proxy uses to log into the minetest servers
+// are derived from the passphrase
+// Generation 0 is the passphrase itself and is the same for every server,
+// newer generations are derived per server so that the auth database
+// of one server can't be used to log into another one
+// The generation of every player on every server is kept in the storage
+// database, outdated passwords are changed using sudo mode
+// when the player is connected to the server
+
+// defaultPassphraseGeneration is the target generation
+// if the passphrase has never been rotated
+const defaultPassphraseGeneration = 1
+
+// serverSecret returns the password for a server in a generation
+func serverSecret(gen int, server string) []byte {
+	if gen == 0 {
+		return passphrase()
+	}
+
+	mac := hmac.New(sha256.New, passphrase())
+	mac.Write([]byte("multiserver:" + strconv.Itoa(gen) + ":" + server))
+	return mac.Sum(nil)
+}
+
+func storageInt(key string, def int) (int, error) {
+	s, err := StorageKey(key)
+	if err != nil || s == "" {
+		return def, err
+	}
+
+	return strconv.Atoi(s)
+}
+
+// PassphraseGeneration returns the generation
+// all passwords are changed to
+func PassphraseGeneration() (int, error) {
+	return storageInt("auth:generation", defaultPassphraseGeneration)
+}
+
+// passwordGeneration returns the generation of the password
+// of a player on a server
+func passwordGeneration(server, name string) (int, error) {
+	return storageInt("auth:generation:"+server+":"+name, 0)
+}
+
+func setPasswordGeneration(server, name string, gen int) error {
+	return SetStorageKey("auth:generation:"+server+":"+name, strconv.Itoa(gen))
+}
+
+// RotatePassphrase increments the target generation and changes
+// the passwords of the players that are connected
+// All other passwords are changed when the players join the servers
+func RotatePassphrase() (int, error) {
+	gen, err := PassphraseGeneration()
+	if err != nil {
+		return 0, err
+	}
+
+	gen++
+	if err := SetStorageKey("auth:generation", strconv.Itoa(gen)); err != nil {
+		return 0, err
+	}
+
+	for _, c := range Conns() {
+		if srv := c.Server(); srv != nil {
+			go srv.updatePassword(c.Username())
+		}
+	}
+
+	rpcSrvMu.Lock()
+	for srv := range rpcSrvs {
+		go srv.updatePassword("rpc")
+	}
+	rpcSrvMu.Unlock()
+
+	return gen, nil
+}
+
+const (
+	rotationSudo = iota
+	rotationChange
+)
+
+// rotationTimeout is the time after which a password change
+// that hasn't been answered by the server is abandoned
+const rotationTimeout = 30 * time.Second
+
+// A passwordRotation is a password change in progress
+type passwordRotation struct {
+	name     string
+	server   string
+	from, to int
+	state    int
+
+	srp_A []byte
+	srp_a []byte
+}
+
+// updatePassword changes the password of a player on the server
+// this Conn is connected to if it is outdated
+// The client state on the server must be active
+func (c *Conn) updatePassword(name string) {
+	server := Conf().ServerByAddr(c.Addr().String())
+	if server == "" {
+		return
+	}
+
+	from, err := passwordGeneration(server, name)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	to, err := PassphraseGeneration()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	if from >= to {
+		return
+	}
+
+	A, a, err := srp.InitiateHandshake()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	c.rotationMu.Lock()
+	if c.rotation != nil {
+		c.rotationMu.Unlock()
+		return
+	}
+
+	rot := &passwordRotation{
+		name:   name,
+		server: server,
+		from:   from,
+		to:     to,
+		state:  rotationSudo,
+		srp_A:  A,
+		srp_a:  a,
+	}
+	c.rotation = rot
+	c.rotationMu.Unlock()
+
+	// Don't block later changes if the server never answers
+	time.AfterFunc(rotationTimeout, func() {
+		c.rotationMu.Lock()
+		defer c.rotationMu.Unlock()
+
+		if c.rotation == rot {
+			log.Print("Server " + server + " didn't answer the password change of " + name + " in time")
+			c.rotation = nil
+		}
+	})
+
+	// Enter sudo mode
+	w := bytes.NewBuffer([]byte{0x00, ToServerSRPBytesA})
+	WriteBytes16(w, A)
+	WriteUint8(w, 1)
+
+	ack, err := c.Send(rudp.Pkt{
+		Reader: w,
+		PktInfo: rudp.PktInfo{
+			Channel: 1,
+		},
+	})
+
+	if err != nil {
+		log.Print(err)
+
+		c.rotationMu.Lock()
+		c.rotation = nil
+		c.rotationMu.Unlock()
+		return
+	}
+	<-ack
+}
+
+// processRotation handles the packets of a password change
+// in progress and reports whether pkt has been consumed
+// c is the server Conn, the sudo mode of the player is handled
+// by the proxy itself and never reaches the server,
+// so these packets always belong to the password change
+func (c *Conn) processRotation(cmd uint16, pkt *bytes.Reader) bool {
+	c.rotationMu.Lock()
+	defer c.rotationMu.Unlock()
+
+	rot := c.rotation
+	if rot == nil {
+		return false
+	}
+
+	r := *pkt
+
+	send := func(w *bytes.Buffer) {
+		ack, err := c.Send(rudp.Pkt{
+			Reader: w,
+			PktInfo: rudp.PktInfo{
+				Channel: 1,
+			},
+		})
+
+		if err != nil {
+			log.Print(err)
+			c.rotation = nil
+			return
+		}
+		<-ack
+	}
+
+	switch cmd {
+	case ToClientSrpBytesSB:
+		if rot.state != rotationSudo {
+			return false
+		}
+
+		// Compute and send SRP_BYTES_M using the old password
+		s := ReadBytes16(&r)
+		B := ReadBytes16(&r)
+
+		name := []byte(strings.ToLower(rot.name))
+		K, err := srp.CompleteHandshake(rot.srp_A, rot.srp_a, name, serverSecret(rot.from, rot.server), s, B)
+		if err != nil {
+			log.Print(err)
+			c.rotation = nil
+			return true
+		}
+
+		M := srp.ClientProof([]byte(rot.name), s, rot.srp_A, B, K)
+
+		w := bytes.NewBuffer([]byte{0x00, ToServerSRPBytesM})
+		WriteBytes16(w, M)
+
+		send(w)
+		return true
+	case ToClientAcceptSudoMode:
+		if rot.state != rotationSudo {
+			return false
+		}
+
+		// Send the new password
+		s, v, err := srp.NewClient([]byte(strings.ToLower(rot.name)), serverSecret(rot.to, rot.server))
+		if err != nil {
+			log.Print(err)
+			c.rotation = nil
+			return true
+		}
+
+		w := bytes.NewBuffer([]byte{0x00, ToServerFirstSRP})
+		WriteBytes16(w, s)
+		WriteBytes16(w, v)
+		WriteUint8(w, 0)
+
+		rot.state = rotationChange
+		send(w)
+		return true
+	case ToClientDenySudoMode:
+		log.Print("Server " + rot.server + " denied sudo mode for the password change of " + rot.name)
+
+		c.rotation = nil
+		return true
+	case ToClientChatMessage:
+		if rot.state != rotationChange {
+			return false
+		}
+
+		// The server reports the result in a system chat message
+		// which has no sender
+		r.Seek(2, io.SeekCurrent)
+
+		if ReadUint16(&r) != 0 {
+			return false
+		}
+
+		msg := make([]byte, int(ReadUint16(&r))*2)
+		r.Read(msg)
+
+		switch string(narrow(msg)) {
+		case "Password change successful.":
+			if err := setPasswordGeneration(rot.server, rot.name, rot.to); err != nil {
+				log.Print(err)
+			}
+
+			log.Print("Changed the password of " + rot.name + " on " + rot.server + " to generation " + strconv.Itoa(rot.to))
+		case "Password change failed or unavailable.":
+			log.Print("Server " + rot.server + " failed to change the password of " + rot.name)
+		default:
+			return false
+		}
+
+		c.rotation = nil
+		return true
+	}
+
+	return false
+}
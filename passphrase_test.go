@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestServerSecret(t *testing.T) {
+	setPassphrase([]byte("passphrase"))
+	defer setPassphrase(nil)
+
+	if s := serverSecret(0, "lobby"); !bytes.Equal(s, []byte("passphrase")) {
+		t.Fatalf("serverSecret(0, lobby) = %q, want the passphrase", s)
+	}
+
+	seen := make(map[string]string)
+	for _, gen := range []int{1, 2} {
+		for _, server := range []string{"lobby", "creative"} {
+			s := string(serverSecret(gen, server))
+			if prev, ok := seen[s]; ok {
+				t.Fatalf("generation %d on %s has the same password as %s", gen, server, prev)
+			}
+			seen[s] = server
+
+			if s != string(serverSecret(gen, server)) {
+				t.Fatalf("serverSecret(%d, %s) is not deterministic", gen, server)
+			}
+		}
+	}
+}
+
+func TestRotatePassphrase(t *testing.T) {
+	testMemBackends(t)
+
+	if gen, err := PassphraseGeneration(); err != nil || gen != defaultPassphraseGeneration {
+		t.Fatalf("PassphraseGeneration() = %d, %v, want %d", gen, err, defaultPassphraseGeneration)
+	}
+
+	for want := defaultPassphraseGeneration + 1; want <= defaultPassphraseGeneration+3; want++ {
+		if gen, err := RotatePassphrase(); err != nil || gen != want {
+			t.Fatalf("RotatePassphrase() = %d, %v, want %d", gen, err, want)
+		}
+
+		if gen, err := PassphraseGeneration(); err != nil || gen != want {
+			t.Fatalf("PassphraseGeneration() after rotating = %d, %v, want %d", gen, err, want)
+		}
+	}
+
+	if gen, err := passwordGeneration("lobby", "bob"); err != nil || gen != 0 {
+		t.Fatalf("passwordGeneration of a new player = %d, %v, want 0", gen, err)
+	}
+
+	if err := setPasswordGeneration("lobby", "bob", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if gen, err := passwordGeneration("lobby", "bob"); err != nil || gen != 3 {
+		t.Fatalf("passwordGeneration(lobby, bob) = %d, %v, want 3", gen, err)
+	}
+
+	if gen, err := passwordGeneration("creative", "bob"); err != nil || gen != 0 {
+		t.Fatalf("passwordGeneration(creative, bob) = %d, %v, want 0", gen, err)
+	}
+}
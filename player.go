@@ -1,12 +1,23 @@
 package main
 
-import "sync"
+import (
+	"regexp"
+	"sync"
+)
 
 const (
 	MaxPlayerNameLength = 20
 	PlayerNameChars     = "[a-zA-Z0-9-_]"
 )
 
+var playerNameRegexp = regexp.MustCompile("^" + PlayerNameChars + "+$")
+
+// ValidPlayerName reports whether a name is accepted
+// by the minetest servers
+func ValidPlayerName(name string) bool {
+	return len(name) <= MaxPlayerNameLength && playerNameRegexp.MatchString(name)
+}
+
 var onlinePlayers map[string]bool
 var onlinePlayerMu sync.RWMutex
 
@@ -27,7 +38,6 @@ func RegisterOnLeavePlayer(function func(*Conn)) {
 
 func processJoin(c *Conn) {
 	onlinePlayerMu.Lock()
-	defer onlinePlayerMu.Unlock()
 
 	cltSrv := c.ServerName()
 	for ; cltSrv == ""; cltSrv = c.ServerName() {
@@ -40,16 +50,21 @@ func processJoin(c *Conn) {
 	rpcSrvMu.Unlock()
 
 	onlinePlayers[c.Username()] = true
+	login := startSession(c)
+
 	for i := range onJoinPlayer {
 		onJoinPlayer[i](c)
 	}
 
+	onlinePlayerMu.Unlock()
+
+	recordLogin(c.Username(), c.IP().String(), login)
+
 	go OptimizeRPCConns()
 }
 
 func processLeave(c *Conn) {
 	onlinePlayerMu.Lock()
-	defer onlinePlayerMu.Unlock()
 
 	rpcSrvMu.Lock()
 	for srv := range rpcSrvs {
@@ -58,9 +73,15 @@ func processLeave(c *Conn) {
 	rpcSrvMu.Unlock()
 
 	onlinePlayers[c.Username()] = false
+	session := endSession(c)
+
 	for i := range onLeavePlayer {
 		onLeavePlayer[i](c)
 	}
+
+	onlinePlayerMu.Unlock()
+
+	recordLogout(c.Username(), session)
 }
 
 // IsOnline reports if a player is connected
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestValidPlayerName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"Bob":                   true,
+		"bob_2-x":               true,
+		"":                      false,
+		"bad name!; DROP":       false,
+		"bob!":                  false,
+		"abcdefghijklmnopqrst":  true,
+		"abcdefghijklmnopqrstu": false,
+	} {
+		if got := ValidPlayerName(name); got != want {
+			t.Errorf("ValidPlayerName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
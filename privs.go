@@ -1,12 +1,9 @@
 package main
 
 import (
-	"database/sql"
-	"errors"
+	"fmt"
 	"log"
 	"strings"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 func encodePrivs(privs map[string]bool) string {
@@ -49,19 +46,7 @@ func decodePrivs(s string) map[string]bool {
 
 // Privs returns the privileges of a player
 func Privs(name string) (map[string]bool, error) {
-	db, err := authDB()
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	var eprivs string
-	err = db.QueryRow(`SELECT privileges FROM privileges WHERE name = $1;`, name).Scan(&eprivs)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return make(map[string]bool), err
-	}
-
-	return decodePrivs(eprivs), nil
+	return Auth().Privs(name)
 }
 
 // Privs returns the privileges of a Conn
@@ -71,32 +56,140 @@ func (c *Conn) Privs() (map[string]bool, error) {
 
 // SetPrivs sets the privileges of a player
 func SetPrivs(name string, privs map[string]bool) error {
-	db, err := authDB()
+	return Auth().SetPrivs(name, privs)
+}
+
+// SetPrivs sets the privileges of a Conn
+func (c *Conn) SetPrivs(privs map[string]bool) error {
+	return SetPrivs(c.Username(), privs)
+}
+
+// Roles returns the roles of a player
+func Roles(name string) (map[string]bool, error) {
+	return Auth().Roles(name)
+}
+
+// Roles returns the roles of a Conn
+func (c *Conn) Roles() (map[string]bool, error) {
+	return Roles(c.Username())
+}
+
+// SetRoles sets the roles of a player
+// Roles that are not defined in the configuration are rejected
+func SetRoles(name string, roles map[string]bool) error {
+	for role, has := range roles {
+		if _, ok := Conf().Roles[role]; has && !ok {
+			return fmt.Errorf("unknown role %s", role)
+		}
+	}
+
+	return Auth().SetRoles(name, roles)
+}
+
+// EffectivePrivs returns the privileges of a player
+// including those granted by its roles
+// Roles that have been removed from the configuration are ignored
+func EffectivePrivs(name string) (map[string]bool, error) {
+	privs, err := Privs(name)
+	if err != nil {
+		return privs, err
+	}
+
+	roles, err := Roles(name)
 	if err != nil {
-		return err
+		return privs, err
 	}
-	defer db.Close()
 
-	_, err = db.Exec(`INSERT INTO privileges (
-	name,
-	privileges
-) VALUES (
-	$1,
-	$2
-);`, name, encodePrivs(privs))
-	_, err = db.Exec(`UPDATE privileges SET privileges = $1 WHERE name = $2;`, encodePrivs(privs), name)
+	conf := Conf()
+	for role := range roles {
+		for _, priv := range conf.Roles[role] {
+			privs[priv] = true
+		}
+	}
 
-	return err
+	return privs, nil
 }
 
-// SetPrivs sets the privileges of a Conn
-func (c *Conn) SetPrivs(privs map[string]bool) error {
-	return SetPrivs(c.Username(), privs)
+// Privileges can be scoped to a server or a server group
+// by appending @ and the name of the server or group, e.g. kick@creative
+// A scoped privilege only applies on that server or the servers
+// of that group, global privileges apply everywhere
+
+// splitPriv splits a privilege into its name and scope,
+// the scope is empty for global privileges
+func splitPriv(priv string) (string, string) {
+	if i := strings.LastIndex(priv, "@"); i >= 0 {
+		return priv[:i], priv[i+1:]
+	}
+
+	return priv, ""
 }
 
-// CheckPrivs reports if a player has all of the specified privileges
+// validPrivScope reports whether a scope names a server or a server group
+func validPrivScope(scope string) bool {
+	conf := Conf()
+	if _, ok := conf.Servers[scope]; ok {
+		return true
+	}
+
+	return conf.IsGroup(scope)
+}
+
+// privScopes returns the scopes that apply to a server or group:
+// its name and the groups containing it
+func privScopes(server string) []string {
+	if server == "" {
+		return nil
+	}
+
+	r := []string{server}
+	for grp, members := range Conf().Groups {
+		for _, member := range members {
+			if member == server {
+				r = append(r, grp)
+				break
+			}
+		}
+	}
+
+	return r
+}
+
+// CheckPrivs reports if a player has all of the specified global
+// privileges either directly or through its roles
 func CheckPrivs(name string, req map[string]bool) (bool, error) {
-	privs, err := Privs(name)
+	return CheckPrivsOn(name, "", req)
+}
+
+// PrivsOn returns the privileges a player has on a server or server group
+// Privileges scoped to it are returned without the scope,
+// privileges scoped to other servers are left out
+func PrivsOn(name, server string) (map[string]bool, error) {
+	privs, err := EffectivePrivs(name)
+	if err != nil {
+		return privs, err
+	}
+
+	applies := make(map[string]bool)
+	for _, scope := range privScopes(server) {
+		applies[scope] = true
+	}
+
+	r := make(map[string]bool)
+	for priv := range privs {
+		if priv, scope := splitPriv(priv); scope == "" || applies[scope] {
+			r[priv] = true
+		}
+	}
+
+	return r, nil
+}
+
+// CheckPrivsOn reports if a player has all of the specified privileges
+// on a server or server group, either globally or scoped to it
+// Only global privileges count if server is empty
+func CheckPrivsOn(name, server string, req map[string]bool) (bool, error) {
+	privs, err := PrivsOn(name, server)
 	if err != nil {
 		return false, err
 	}
@@ -111,12 +204,48 @@ func CheckPrivs(name string, req map[string]bool) (bool, error) {
 }
 
 // CheckPrivs reports if a Conn has all of the specified privileges
+// on the server it is connected to
 func (c *Conn) CheckPrivs(req map[string]bool) (bool, error) {
-	return CheckPrivs(c.Username(), req)
+	var server string
+	if srv := c.Server(); srv != nil {
+		server = Conf().ServerByAddr(srv.Addr().String())
+	}
+
+	return CheckPrivsOn(c.Username(), server, req)
+}
+
+// checkCommandPrivs reports if a Conn has the privileges required
+// to run a chat command, scoped privileges only count for scopedCommands
+func (c *Conn) checkCommandPrivs(cmd string) (bool, error) {
+	if scopedCommands[cmd] {
+		return c.CheckPrivs(chatCommands[cmd].privs)
+	}
+
+	return CheckPrivs(c.Username(), chatCommands[cmd].privs)
+}
+
+// DefaultPrivs returns the privileges new accounts are created with:
+// default_privs and the group_default_privs scoped to their groups
+func DefaultPrivs() map[string]bool {
+	conf := Conf()
+
+	r := make(map[string]bool)
+	for _, priv := range conf.DefaultPrivs {
+		r[priv] = true
+	}
+
+	for grp, privs := range conf.GroupDefaultPrivs {
+		for _, priv := range privs {
+			r[priv+"@"+grp] = true
+		}
+	}
+
+	return r
 }
 
-func init() {
-	if admin, ok := ConfKey("admin").(string); ok {
+// grantAdminPrivs grants the privs privilege to the configured admin
+func grantAdminPrivs() {
+	if admin := Conf().Admin; admin != "" {
 		privs, err := Privs(admin)
 		if err != nil {
 			log.Print(err)
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	testMemBackends(t)
+	testConf(t, func(c *Config) {
+		c.Roles = map[string][]string{
+			"moderator": {"kick", "mute"},
+			"builder":   {"fly"},
+		}
+	})
+
+	if err := SetPrivs("bob", privs("interact")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetRoles("bob", privs("moderator", "builder")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetRoles("bob", privs("admin")); err == nil {
+		t.Fatal("SetRoles accepted the unknown role admin")
+	}
+
+	if p, err := EffectivePrivs("bob"); err != nil || !reflect.DeepEqual(p, privs("interact", "kick", "mute", "fly")) {
+		t.Fatalf("EffectivePrivs(bob) = %v, %v", p, err)
+	}
+
+	// Roles removed from the configuration are ignored
+	testConf(t, func(c *Config) {
+		c.Roles = map[string][]string{"builder": {"fly"}}
+	})
+
+	if p, err := EffectivePrivs("bob"); err != nil || !reflect.DeepEqual(p, privs("interact", "fly")) {
+		t.Fatalf("EffectivePrivs(bob) after removing moderator = %v, %v", p, err)
+	}
+
+	if p, err := Privs("bob"); err != nil || !reflect.DeepEqual(p, privs("interact")) {
+		t.Fatalf("Privs(bob) = %v, %v, want the privileges without roles", p, err)
+	}
+}
+
+func TestPrivScopes(t *testing.T) {
+	testMemBackends(t)
+	testConf(t, func(c *Config) {
+		c.Groups = map[string][]string{
+			"public":  {"survival", "minigames"},
+			"private": {"creative"},
+		}
+		c.Roles = map[string][]string{"builder": {"fly@private"}}
+	})
+
+	for server, want := range map[string][]string{
+		"survival": {"survival", "public"},
+		"creative": {"creative", "private"},
+		"lobby":    {"lobby"},
+		"":         nil,
+	} {
+		if got := privScopes(server); !reflect.DeepEqual(got, want) {
+			t.Errorf("privScopes(%q) = %v, want %v", server, got, want)
+		}
+	}
+
+	if err := SetPrivs("bob", privs("interact", "kick@creative", "send@public")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetRoles("bob", privs("builder")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		server string
+		req    map[string]bool
+		want   bool
+	}{
+		{"", privs("interact"), true},
+		{"", privs("kick"), false},
+		{"creative", privs("interact", "kick"), true},
+		{"creative", privs("fly"), true},
+		{"creative", privs("send"), false},
+		{"survival", privs("kick"), false},
+		{"survival", privs("send"), true},
+		{"minigames", privs("send"), true},
+		{"public", privs("send"), true},
+		{"private", privs("kick"), false},
+		{"lobby", privs("fly"), false},
+	} {
+		if got, err := CheckPrivsOn("bob", tc.server, tc.req); err != nil || got != tc.want {
+			t.Errorf("CheckPrivsOn(bob, %q, %v) = %v, %v, want %v", tc.server, tc.req, got, err, tc.want)
+		}
+	}
+
+	if p, err := PrivsOn("bob", "creative"); err != nil || !reflect.DeepEqual(p, privs("interact", "kick", "fly")) {
+		t.Fatalf("PrivsOn(bob, creative) = %v, %v", p, err)
+	}
+}
@@ -33,9 +33,7 @@ func Proxy(src, dst *Conn) {
 				}
 
 				if !src.IsSrv() {
-					connectedConnsMu.Lock()
-					connectedConns--
-					connectedConnsMu.Unlock()
+					removeConnectedConn(src)
 
 					processLeave(src)
 				}
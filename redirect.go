@@ -46,28 +46,30 @@ func (c *Conn) Redirect(newsrv string) error {
 
 	defer processRedirectDone(c, &newsrv)
 
-	straddr, ok := ConfKey("servers:" + newsrv + ":address").(string)
-	if !ok {
-		grp, ok := ConfKey("groups:" + newsrv).([]interface{})
+	conf := Conf()
+
+	straddr := conf.Servers[newsrv].Address
+	if straddr == "" {
+		grp, ok := conf.Groups[newsrv]
 		if !ok {
 			return fmt.Errorf("server or group %s does not exist", newsrv)
 		}
 
 		smallestCnt := int(^uint(0) >> 1)
 		for _, srv := range grp {
-			cnt := len(ConnsServer(srv.(string)))
+			cnt := len(ConnsServer(srv))
 			if cnt < smallestCnt {
-				if c.ServerName() == srv.(string) {
-					return fmt.Errorf("already connected to server %s", srv.(string))
+				if c.ServerName() == srv {
+					return fmt.Errorf("already connected to server %s", srv)
 				}
 
 				smallestCnt = cnt
-				newsrv = srv.(string)
+				newsrv = srv
 			}
 		}
 
-		straddr, ok = ConfKey("servers:" + newsrv + ":address").(string)
-		if !ok {
+		straddr = conf.Servers[newsrv].Address
+		if straddr == "" {
 			return fmt.Errorf("server %s does not exist", newsrv)
 		}
 	}
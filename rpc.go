@@ -78,9 +78,13 @@ func processRpc(c *Conn, r *bytes.Reader) bool {
 	case "<-ALERT":
 		ChatSendAll(strings.Join(strings.Split(msg, " ")[2:], " "))
 	case "<-GETDEFSRV":
-		defsrv, ok := ConfKey("default_server").(string)
-		if !ok {
-			return true
+		// The default server can differ per listener, it is resolved
+		// through the listener of the player if one is named
+		defsrv := Conf().DefaultServer
+		if args := strings.Split(msg, " "); len(args) > 2 {
+			if c2 := ConnByUsername(args[2]); c2 != nil {
+				defsrv = c2.ListenerConf().DefaultServer
+			}
 		}
 		go c.doRpc("->DEFSRV "+defsrv, rq)
 	case "<-GETPEERCNT":
@@ -97,7 +101,7 @@ func processRpc(c *Conn, r *bytes.Reader) bool {
 		privs := decodePrivs(strings.Join(strings.Split(msg, " ")[3:], " "))
 		hasprivs := "false"
 
-		has, err := CheckPrivs(name, privs)
+		has, err := CheckPrivsOn(name, Conf().ServerByAddr(c.Addr().String()), privs)
 		if err == nil && has {
 			hasprivs = "true"
 		}
@@ -117,7 +121,12 @@ func processRpc(c *Conn, r *bytes.Reader) bool {
 		name := strings.Split(msg, " ")[2]
 		privs := decodePrivs(strings.Join(strings.Split(msg, " ")[3:], " "))
 
-		SetPrivs(name, privs)
+		if err := SetPrivs(name, privs); err != nil {
+			log.Print(err)
+			return true
+		}
+
+		Audit(c.rpcIssuer(), "setprivs", name, strings.Replace(encodePrivs(privs), "|", ",", -1))
 	case "<-GETSRV":
 		name := strings.Split(msg, " ")[2]
 		var srv string
@@ -129,6 +138,7 @@ func processRpc(c *Conn, r *bytes.Reader) bool {
 		name := strings.Split(msg, " ")[2]
 		tosrv := strings.Split(msg, " ")[3]
 		if IsOnline(name) {
+			Audit(c.rpcIssuer(), "send", name, tosrv)
 			go ConnByUsername(name).Redirect(tosrv)
 		}
 	case "<-GETADDR":
@@ -138,44 +148,104 @@ func processRpc(c *Conn, r *bytes.Reader) bool {
 			addr = ConnByUsername(name).Addr().String()
 		}
 		go c.doRpc("->ADDR "+addr, rq)
+	case "<-GETACTIVITY":
+		name := strings.Split(msg, " ")[2]
+		var r string
+
+		a, err := PlayerActivity(name)
+		if err == nil && a != nil {
+			r = strconv.FormatInt(unixOrNone(a.FirstLogin), 10) + " " + strconv.FormatInt(unixOrNone(a.LastLogin), 10) + " " +
+				strconv.FormatInt(int64(a.Playtime/time.Second), 10) + " " + a.LastAddr
+		}
+
+		go c.doRpc("->ACTIVITY "+r, rq)
 	case "<-ISBANNED":
 		target := strings.Split(msg, " ")[2]
 
+		var banned bool
 		if net.ParseIP(target) == nil {
-			return true
+			ban, err := FindNameBan(target)
+			if err != nil {
+				return true
+			}
+
+			banned = ban != nil
+		} else {
+			var err error
+			if banned, _, err = IsBanned(target); err != nil {
+				return true
+			}
+		}
+
+		r := "false"
+		if banned {
+			r = "true"
 		}
 
-		banned, _, err := IsBanned(target)
+		go c.doRpc("->ISBANNED "+r, rq)
+	case "<-ISMUTED":
+		target := strings.Split(msg, " ")[2]
+
+		m, err := FindMute(target)
 		if err != nil {
 			return true
 		}
 
 		r := "false"
-		if banned {
+		if m != nil {
 			r = "true"
 		}
 
-		go c.doRpc("->ISBANNED "+r, rq)
+		go c.doRpc("->ISMUTED "+r, rq)
 	case "<-BAN":
-		target := strings.Split(msg, " ")[2]
-		err := Ban(target, "not known")
+		args := strings.SplitN(msg, " ", 4)
+		target, d, reason, err := parseBanParams(strings.Join(args[2:], " "))
 		if err != nil {
-			c2 := ConnByUsername(target)
-			if c2 == nil {
-				return true
-			}
+			log.Print(err)
+			return true
+		}
+
+		if err := banTarget(target, d, reason, c.rpcIssuer()); err != nil {
+			log.Print(err)
+			return true
+		}
+
+		Audit(c.rpcIssuer(), "ban ip", target, strings.Join(args[3:], " "))
+	case "<-BANNAME":
+		args := strings.SplitN(msg, " ", 4)
+		target, d, reason, err := parseBanParams(strings.Join(args[2:], " "))
+		if err != nil {
+			log.Print(err)
+			return true
+		}
 
-			c2.Ban()
+		if err := BanName(target, d, reason, c.rpcIssuer()); err != nil {
+			log.Print(err)
+			return true
 		}
+
+		Audit(c.rpcIssuer(), "ban name", target, strings.Join(args[3:], " "))
 	case "<-UNBAN":
 		target := strings.Split(msg, " ")[2]
-		Unban(target)
+		if err := Unban(target); err != nil {
+			log.Print(err)
+			return true
+		}
+
+		Audit(c.rpcIssuer(), "unban ip", target, "")
+	case "<-UNBANNAME":
+		target := strings.Split(msg, " ")[2]
+		if err := UnbanName(target); err != nil {
+			log.Print(err)
+			return true
+		}
+
+		Audit(c.rpcIssuer(), "unban name", target, "")
 	case "<-GETSRVS":
 		var srvs string
 
-		servers := ConfKey("servers").(map[interface{}]interface{})
-		for server := range servers {
-			srvs += server.(string) + ","
+		for server := range Conf().Servers {
+			srvs += server + ","
 		}
 		srvs = srvs[:len(srvs)-1]
 
@@ -191,8 +261,8 @@ func processRpc(c *Conn, r *bytes.Reader) bool {
 		rpcSrvMu.Unlock()
 	case "<-MSG2MT":
 		tosrv := strings.Split(msg, " ")[2]
-		addr, ok := ConfKey("servers:" + tosrv + ":address").(string)
-		if !ok || addr == c.Addr().String() {
+		addr := Conf().Servers[tosrv].Address
+		if addr == "" || addr == c.Addr().String() {
 			return true
 		}
 
@@ -208,6 +278,16 @@ func processRpc(c *Conn, r *bytes.Reader) bool {
 	return true
 }
 
+// rpcIssuer returns the issuer of actions requested by the RPC server
+// this Conn is connected to
+func (c *Conn) rpcIssuer() string {
+	if srv := Conf().ServerByAddr(c.Addr().String()); srv != "" {
+		return "rpc:" + srv
+	}
+
+	return "rpc"
+}
+
 func (c *Conn) doRpc(rpc, rq string) {
 	if !c.UseRpc() {
 		return
@@ -228,13 +308,10 @@ func (c *Conn) doRpc(rpc, rq string) {
 func connectRpc() {
 	log.Print("Establishing RPC connections")
 
-	servers := ConfKey("servers").(map[interface{}]interface{})
-	for server := range servers {
+	for _, server := range Conf().Servers {
 		clt := &Conn{username: "rpc"}
 
-		straddr := ConfKey("servers:" + server.(string) + ":address")
-
-		srvaddr, err := net.ResolveUDPAddr("udp", straddr.(string))
+		srvaddr, err := net.ResolveUDPAddr("udp", server.Address)
 		if err != nil {
 			log.Print(err)
 			continue
@@ -286,7 +363,12 @@ func handleRpc(srv *Conn) {
 
 		r := ByteReader(pkt)
 
-		switch cmd := ReadUint16(r); cmd {
+		cmd := ReadUint16(r)
+		if srv.processRotation(cmd, r) {
+			continue
+		}
+
+		switch cmd {
 		case ToClientModChannelSignal:
 			r.Seek(1, io.SeekCurrent)
 
@@ -357,12 +439,11 @@ ServerLoop:
 }
 
 func reconnectRpc(media bool) {
-	servers := ConfKey("servers").(map[interface{}]interface{})
 ServerLoop:
-	for server := range servers {
+	for server, srvConf := range Conf().Servers {
 		clt := &Conn{username: "rpc"}
 
-		straddr := ConfKey("servers:" + server.(string) + ":address").(string)
+		straddr := srvConf.Address
 
 		rpcSrvMu.Lock()
 		for rpcsrv := range rpcSrvs {
@@ -376,7 +457,7 @@ ServerLoop:
 		// Also refetch media in case something has not
 		// been downloaded yet
 		if media {
-			loadMedia(map[string]struct{}{server.(string): {}})
+			loadMedia(map[string]struct{}{server: {}})
 		}
 
 		srvaddr, err := net.ResolveUDPAddr("udp", straddr)
@@ -417,11 +498,12 @@ func init() {
 	rpcSrvMu.Lock()
 	rpcSrvs = make(map[*Conn]struct{})
 	rpcSrvMu.Unlock()
+}
 
-	reconnect, ok := ConfKey("server_reintegration_interval").(int)
-	if !ok {
-		reconnect = 600
-	}
+// initRpc connects to the RPC of all servers
+// and reconnects periodically
+func initRpc() {
+	reconnect := Conf().ServerReintegrationInterval
 
 	connectRpc()
 
@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"net/textproto"
+	"strings"
 	"time"
 )
 
@@ -17,83 +18,93 @@ const (
 	AnnounceDelete = "delete"
 )
 
+// Announce updates the serverlist entries of all listeners
+// that have a serverlist URL
+// Listeners that share the announced address and port,
+// e.g. the IPv4 and IPv6 sockets of a dual-stack setup,
+// are announced as a single entry
 func Announce(action string) error {
-	listsrv, ok := ConfKey("serverlist_url").(string)
-	if !ok {
-		return nil
-	}
+	var r error
+
+	var keys []string
+	hosts := make(map[string][]string)
+	for _, l := range Conf().Host {
+		conf := Conf().ForListener(l.Address)
+		if conf.ServerlistURL == "" {
+			continue
+		}
 
-	log.Print("Updating server list announcement")
+		_, port, _ := net.SplitHostPort(l.Address)
 
-	host, ok := ConfKey("host").(string)
-	if !ok {
-		host = "0.0.0.0:33000"
+		key := conf.ServerlistURL + " " + conf.ServerlistAddress + " " + port
+		if hosts[key] == nil {
+			keys = append(keys, key)
+		}
+		hosts[key] = append(hosts[key], l.Address)
 	}
 
-	addr, err := net.ResolveUDPAddr("udp", host)
-	if err != nil {
-		return err
+	for _, key := range keys {
+		if err := announce(action, hosts[key]); err != nil {
+			log.Print(err)
+			r = err
+		}
 	}
 
-	conns := Conns()
+	return r
+}
 
-	mods, ok := ConfKey("serverlist_mods").([]string)
-	if !ok {
-		mods = make([]string, 0)
-	}
+// announce updates the serverlist entry of the listeners on hosts
+// using the settings of the first one
+func announce(action string, hosts []string) error {
+	conf := Conf().ForListener(hosts[0])
 
-	clients_list := make([]string, 0)
-	for _, conn := range conns {
-		clients_list = append(clients_list, conn.Username())
-	}
+	log.Print("Updating server list announcement of " + strings.Join(hosts, ", "))
 
-	maxPeers, ok := ConfKey("player_limit").(int)
-	if !ok {
-		maxPeers = int(^uint(0) >> 1)
+	addr, err := net.ResolveUDPAddr(listenNetwork(hosts[0]), hosts[0])
+	if err != nil {
+		return err
 	}
 
-	conf := func(key string) interface{} {
-		value, ok := ConfKey(key).(string)
-		if !ok {
-			return ""
-		}
-		return value
+	mods := conf.ServerlistMods
+	if mods == nil {
+		mods = make([]string, 0)
 	}
 
-	confBool := func(key string) interface{} {
-		value, ok := ConfKey(key).(bool)
-		if !ok {
-			return false
+	clients_list := make([]string, 0)
+	for _, conn := range Conns() {
+		for _, host := range hosts {
+			if conn.host == host {
+				clients_list = append(clients_list, conn.Username())
+			}
 		}
-		return value
 	}
 
 	data := make(map[string]interface{})
 	data["action"] = action
 	data["port"] = addr.Port
-	data["address"] = conf("serverlist_address")
+	data["address"] = conf.ServerlistAddress
 
 	if action != AnnounceDelete {
-		data["name"] = conf("serverlist_name")
-		data["description"] = conf("serverlist_desc")
+		data["name"] = conf.ServerlistName
+		data["description"] = conf.ServerlistDesc
 		data["version"] = "multiserver v1.13.2"
 		data["proto_min"] = ProtoMin
 		data["proto_max"] = ProtoLatest
-		data["url"] = conf("serverlist_display_url")
-		data["creative"] = confBool("serverlist_creative")
-		data["damage"] = confBool("serverlist_damage")
-		data["password"] = confBool("disallow_empty_passwords")
-		data["pvp"] = confBool("serverlist_pvp")
+		data["url"] = conf.ServerlistDisplayURL
+		data["creative"] = conf.ServerlistCreative
+		data["damage"] = conf.ServerlistDamage
+		data["password"] = conf.DisallowEmptyPasswords
+		data["pvp"] = conf.ServerlistPvP
 		data["uptime"] = Uptime()
 		data["game_time"] = 0
-		data["clients"] = ConnCount()
-		data["clients_max"] = maxPeers
+		data["clients"] = len(clients_list)
+		data["clients_max"] = conf.PlayerLimit
 		data["clients_list"] = clients_list
-		data["gameid"] = conf("serverlist_game")
+		data["gameid"] = conf.ServerlistGame
 	}
 
 	if action == AnnounceStart {
-		data["can_see_far_names"] = confBool("serverlist_can_see_far_names")
+		data["can_see_far_names"] = conf.ServerlistCanSeeFarNames
 		data["mods"] = mods
 	}
 
@@ -112,7 +123,7 @@ func Announce(action string) error {
 	part.Write(s)
 	writer.Close()
 
-	_, err = http.Post(listsrv+"/announce", "multipart/form-data; boundary="+writer.Boundary(), rqBody)
+	_, err = http.Post(conf.ServerlistURL+"/announce", "multipart/form-data; boundary="+writer.Boundary(), rqBody)
 	if err != nil {
 		return err
 	}
@@ -120,11 +131,9 @@ func Announce(action string) error {
 	return nil
 }
 
-func init() {
-	reannounce, ok := ConfKey("serverlist_announce_interval").(int)
-	if !ok {
-		reannounce = 300
-	}
+// initAnnounce updates the serverlist entry periodically
+func initAnnounce() {
+	reannounce := Conf().ServerlistAnnounceInterval
 
 	go func() {
 		announce := time.NewTicker(time.Duration(reannounce) * time.Second)
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"log"
 	"os"
 	"os/signal"
 	"syscall"
 )
 
-func init() {
+// initSignals handles shutdown and reload signals
+func initSignals() {
 	go func() {
 		signalChan := make(chan os.Signal, 1)
 		signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
@@ -14,4 +16,15 @@ func init() {
 
 		End(false, false)
 	}()
+
+	go func() {
+		reloadChan := make(chan os.Signal, 1)
+		signal.Notify(reloadChan, syscall.SIGHUP)
+
+		for range reloadChan {
+			if err := ReloadConfig(); err != nil {
+				log.Print(err)
+			}
+		}
+	}()
 }
@@ -3,27 +3,253 @@ package main
 import (
 	"database/sql"
 	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+var storageDb *DB
+var storageDbMu sync.Mutex
+
+// storageDB returns the storage database
+// It is opened on first use and stays open until End is called
+// Opening is retried on the next call if it fails
 func storageDB() (*DB, error) {
-	return OpenSQLite3("storage.sqlite", `CREATE TABLE IF NOT EXISTS storage (
+	storageDbMu.Lock()
+	defer storageDbMu.Unlock()
+
+	if storageDb == nil {
+		db, err := openStorageDB()
+		if err != nil {
+			return nil, err
+		}
+
+		storageDb = db
+	}
+
+	return storageDb, nil
+}
+
+// storageMigrations are the versions of the storage database schema
+// New migrations must be appended, existing ones must never be changed
+var storageMigrations = []Migration{
+	{SQLite3: `CREATE TABLE IF NOT EXISTS storage (
 	key VARCHAR(512) PRIMARY KEY NOT NULL,
 	value VARCHAR(512) NOT NULL
-);`)
+);`},
 }
 
-// StorageKey returns an entry from the storage database
+func openStorageDB() (*DB, error) {
+	db, err := OpenConfDB("storage.sqlite")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Migrate("storage", storageMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if db.Type() == DBTypePSQL {
+		if err := migrateStorageSQLite3(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// migrateStorageSQLite3 copies the entries of an existing SQLite3
+// storage database to db and renames the SQLite3 database
+// so that this only happens once
+// Existing entries are kept because the database may already be
+// shared with other proxies, e.g. their passphrase
+// The keys of SQLite3 entries that are skipped are logged
+func migrateStorageSQLite3(db *DB) error {
+	if _, err := os.Stat(DataPath("storage.sqlite")); os.IsNotExist(err) {
+		return nil
+	}
+
+	log.Print("Copying storage.sqlite to the PostgreSQL database")
+
+	old, err := OpenSQLite3("storage.sqlite", "")
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+
+	if err := old.Migrate("storage", storageMigrations); err != nil {
+		return err
+	}
+
+	rows, err := old.Query(`SELECT key, value FROM storage;`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	var skipped []string
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if key == "auth:passphrase" && !strings.HasPrefix(value, "base64:") {
+			value = encodePassphrase([]byte(value))
+		}
+
+		res, err := tx.Exec(db.rebind(storageInsertNew), key, value)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if added, err := res.RowsAffected(); err == nil && added == 0 {
+			skipped = append(skipped, key)
+			continue
+		}
+
+		n++
+	}
+
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Print("Copied ", n, " storage entries")
+
+	for _, key := range skipped {
+		log.Print("Kept existing storage entry " + key + " instead of the one from storage.sqlite")
+	}
+
+	return os.Rename(DataPath("storage.sqlite"), DataPath("storage.sqlite.migrated"))
+}
+
+const storageUpsert = `INSERT INTO storage (
+	key,
+	value
+) VALUES (
+	$1,
+	$2
+) ON CONFLICT (key) DO UPDATE SET value = excluded.value;`
+
+const storageInsertNew = `INSERT INTO storage (
+	key,
+	value
+) VALUES (
+	$1,
+	$2
+) ON CONFLICT (key) DO NOTHING;`
+
+// A StorageBackend stores the key/value entries of the proxy
+// An empty value deletes an entry
+type StorageBackend interface {
+	StorageKey(key string) (string, error)
+	SetStorageKey(key, value string) error
+	StorageEntries() (map[string]string, error)
+}
+
+var storageBackend StorageBackend
+var storageBackendMu sync.RWMutex
+
+// Storage returns the StorageBackend that is in use
+// Entries are kept in memory if auth_backend is memory
+// and in the storage database otherwise
+// unless SetStorageBackend has been called before
+func Storage() StorageBackend {
+	storageBackendMu.RLock()
+	b := storageBackend
+	storageBackendMu.RUnlock()
+
+	if b != nil {
+		return b
+	}
+
+	storageBackendMu.Lock()
+	defer storageBackendMu.Unlock()
+
+	if storageBackend == nil {
+		switch Conf().AuthBackend {
+		case "memory":
+			storageBackend = NewMemStorageBackend()
+		default:
+			storageBackend = &SQLStorageBackend{}
+		}
+	}
+
+	return storageBackend
+}
+
+// SetStorageBackend replaces the StorageBackend
+// This should be done before the proxy starts accepting clients
+func SetStorageBackend(b StorageBackend) {
+	storageBackendMu.Lock()
+	defer storageBackendMu.Unlock()
+
+	storageBackend = b
+}
+
+// StorageKey returns an entry from the storage backend
 func StorageKey(key string) (string, error) {
-	db, err := storageDB()
+	return Storage().StorageKey(key)
+}
+
+// SetStorageKey sets an entry in the storage backend
+func SetStorageKey(key, value string) error {
+	return Storage().SetStorageKey(key, value)
+}
+
+// StorageEntries returns all entries of the storage backend
+func StorageEntries() (map[string]string, error) {
+	return Storage().StorageEntries()
+}
+
+// A SQLStorageBackend is a StorageBackend that uses
+// a SQLite3 or PostgreSQL database
+// The storage database is used if db is nil
+type SQLStorageBackend struct {
+	db *DB
+}
+
+// NewSQLStorageBackend returns a StorageBackend that uses db
+func NewSQLStorageBackend(db *DB) *SQLStorageBackend {
+	return &SQLStorageBackend{db: db}
+}
+
+func (b *SQLStorageBackend) database() (*DB, error) {
+	if b.db != nil {
+		return b.db, nil
+	}
+
+	return storageDB()
+}
+
+// StorageKey returns an entry from the storage database
+func (b *SQLStorageBackend) StorageKey(key string) (string, error) {
+	db, err := b.database()
 	if err != nil {
 		return "", err
 	}
-	defer db.Close()
 
 	var r string
-	err = db.QueryRow(`SELECT value FROM storage WHERE key = ?;`, key).Scan(&r)
+	err = db.QueryRow(`SELECT value FROM storage WHERE key = $1;`, key).Scan(&r)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return "", err
 	}
@@ -32,23 +258,44 @@ func StorageKey(key string) (string, error) {
 }
 
 // SetStorageKey sets an entry in the storage database
-func SetStorageKey(key, value string) error {
-	db, err := storageDB()
+func (b *SQLStorageBackend) SetStorageKey(key, value string) error {
+	db, err := b.database()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
 	if value == "" {
-		_, err = db.Exec(`DELETE FROM storage WHERE key = ?;`)
+		_, err = db.Exec(`DELETE FROM storage WHERE key = $1;`, key)
 	} else {
-		_, err = db.Exec(`REPLACE INTO storage (
-			key,
-			value
-		) VALUES (
-			?,
-			?
-		);`, key, value)
+		_, err = db.Exec(storageUpsert, key, value)
 	}
 	return err
 }
+
+// StorageEntries returns all entries of the storage database
+func (b *SQLStorageBackend) StorageEntries() (map[string]string, error) {
+	db, err := b.database()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT key, value FROM storage;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := make(map[string]string)
+
+	for rows.Next() {
+		var key, value string
+
+		if err = rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+
+		r[key] = value
+	}
+
+	return r, rows.Err()
+}
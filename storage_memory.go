@@ -0,0 +1,52 @@
+package main
+
+import "sync"
+
+// A MemStorageBackend is a StorageBackend that keeps everything in memory
+// It is useful for tests and plugins, nothing is persisted
+type MemStorageBackend struct {
+	mu      sync.RWMutex
+	entries map[string]string
+}
+
+// NewMemStorageBackend returns an empty MemStorageBackend
+func NewMemStorageBackend() *MemStorageBackend {
+	return &MemStorageBackend{
+		entries: make(map[string]string),
+	}
+}
+
+// StorageKey returns an entry
+func (b *MemStorageBackend) StorageKey(key string) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.entries[key], nil
+}
+
+// SetStorageKey sets an entry
+func (b *MemStorageBackend) SetStorageKey(key, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if value == "" {
+		delete(b.entries, key)
+	} else {
+		b.entries[key] = value
+	}
+
+	return nil
+}
+
+// StorageEntries returns all entries
+func (b *MemStorageBackend) StorageEntries() (map[string]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	r := make(map[string]string)
+	for key, value := range b.entries {
+		r[key] = value
+	}
+
+	return r, nil
+}
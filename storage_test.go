@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func testStorageBackend(t *testing.T, b StorageBackend) {
+	if v, err := b.StorageKey("missing"); err != nil || v != "" {
+		t.Fatalf("StorageKey(missing) = %q, %v", v, err)
+	}
+
+	if err := b.SetStorageKey("server:bob", "lobby"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SetStorageKey("server:bob", "creative"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := b.StorageKey("server:bob"); err != nil || v != "creative" {
+		t.Fatalf("StorageKey(server:bob) = %q, %v", v, err)
+	}
+
+	entries, err := b.StorageEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries["server:bob"] != "creative" {
+		t.Fatalf("StorageEntries() = %v", entries)
+	}
+
+	if err := b.SetStorageKey("server:bob", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := b.StorageKey("server:bob"); err != nil || v != "" {
+		t.Fatalf("StorageKey(server:bob) after delete = %q, %v", v, err)
+	}
+}
+
+func TestMemStorageBackend(t *testing.T) {
+	testStorageBackend(t, NewMemStorageBackend())
+}
+
+func TestSQLStorageBackend(t *testing.T) {
+	testStorageBackend(t, NewSQLStorageBackend(testSQLite3(t, "storage", storageMigrations)))
+}